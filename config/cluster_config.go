@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ClusterConfig describes one Vitastor cluster monitored by the exporter.
+// Connection settings are read from VitastorConf if it is set and can be
+// overridden by the same keys given inline.
+type ClusterConfig struct {
+	Name         string `json:"name"`
+	VitastorConf string `json:"vitastor_conf,omitempty"`
+	// ProbeTargets lists the etcd addresses /probe requests using this
+	// profile may name as target. It is only used by probe profiles.
+	ProbeTargets EtcdAddress `json:"probe_targets,omitempty"`
+	VitastorConfig
+}
+
+// ConfigFile is the exporter config passed with --config. It lists the
+// clusters to monitor and the named profiles /probe requests may refer to.
+type ConfigFile struct {
+	Clusters      []ClusterConfig
+	ProbeProfiles map[string]ClusterConfig
+}
+
+type rawConfigFile struct {
+	Clusters      []json.RawMessage          `json:"clusters"`
+	ProbeProfiles map[string]json.RawMessage `json:"probe_profiles"`
+}
+
+// LoadVitastorConfig reads vitastor.conf into config, keeping the values of
+// keys missing from the file.
+func LoadVitastorConfig(file string, config *VitastorConfig) error {
+	configFile, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer configFile.Close()
+	return json.NewDecoder(configFile).Decode(config)
+}
+
+// LoadConfigFile reads the exporter config file.
+func LoadConfigFile(file string) (*ConfigFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var parsed rawConfigFile
+	err = json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.Clusters) == 0 && len(parsed.ProbeProfiles) == 0 {
+		return nil, fmt.Errorf("neither clusters nor probe profiles defined in %s", file)
+	}
+	configFile := &ConfigFile{
+		Clusters:      make([]ClusterConfig, 0, len(parsed.Clusters)),
+		ProbeProfiles: make(map[string]ClusterConfig, len(parsed.ProbeProfiles)),
+	}
+	names := make(map[string]bool)
+	for i, raw := range parsed.Clusters {
+		cluster, err := parseClusterConfig(raw)
+		if err != nil {
+			return nil, fmt.Errorf("cluster #%d: %v", i, err)
+		}
+		if cluster.Name == "" {
+			return nil, fmt.Errorf("cluster #%d: name is not set", i)
+		}
+		if names[cluster.Name] {
+			return nil, fmt.Errorf("cluster %s is defined twice", cluster.Name)
+		}
+		names[cluster.Name] = true
+		err = cluster.Normalize()
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", cluster.Name, err)
+		}
+		configFile.Clusters = append(configFile.Clusters, cluster)
+	}
+	// Profiles are normalized per request, once the probe target is applied
+	for name, raw := range parsed.ProbeProfiles {
+		profile, err := parseClusterConfig(raw)
+		if err != nil {
+			return nil, fmt.Errorf("probe profile %s: %v", name, err)
+		}
+		profile.Name = name
+		if profile.HasCredentials() && len(profile.VitastorEtcdUrls) == 0 && len(profile.ProbeTargets) == 0 {
+			return nil, fmt.Errorf("probe profile %s has credentials, so it needs etcd_address or probe_targets", name)
+		}
+		configFile.ProbeProfiles[name] = profile
+	}
+	return configFile, nil
+}
+
+// parseClusterConfig decodes one cluster entry. If it refers to a
+// vitastor.conf, that file is loaded first and the inline keys are applied on
+// top of it.
+func parseClusterConfig(raw json.RawMessage) (ClusterConfig, error) {
+	var cluster ClusterConfig
+	err := json.Unmarshal(raw, &cluster)
+	if err != nil {
+		return cluster, err
+	}
+	if cluster.VitastorConf != "" {
+		cluster.VitastorConfig = VitastorConfig{}
+		err = LoadVitastorConfig(cluster.VitastorConf, &cluster.VitastorConfig)
+		if err != nil {
+			return cluster, err
+		}
+		err = json.Unmarshal(raw, &cluster)
+		if err != nil {
+			return cluster, err
+		}
+	}
+	return cluster, nil
+}
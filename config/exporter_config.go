@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExporterConfig holds settings of the exporter itself, as opposed to
+// VitastorConfig which describes how to reach the cluster.
+type ExporterConfig struct {
+	// EtcdWatch keeps an in-memory copy of the Vitastor tree updated by an
+	// etcd watch. When disabled, every scrape reads etcd directly.
+	EtcdWatch bool
+	// PGStatsPerPG exports object counts of every PG in addition to the
+	// per-pool sums.
+	PGStatsPerPG bool
+	// OSDInodeStatsLimit is the maximal number of OSD and image pairs whose
+	// IO counters are exported, 0 disables them.
+	OSDInodeStatsLimit int
+	// OSDSpacePerImage exports space used by every image on every OSD in
+	// addition to the per-image and per-pool sums.
+	OSDSpacePerImage bool
+	// RecoveryRateWindow is the time over which the recovery rate of pools
+	// is measured.
+	RecoveryRateWindow time.Duration
+
+	EtcdDialTimeout time.Duration
+	// EtcdRequestTimeout limits a single attempt of an etcd request
+	EtcdRequestTimeout time.Duration
+	// EtcdRetries is the number of times a failed request is retried
+	EtcdRetries         int
+	EtcdRetryBackoff    time.Duration
+	EtcdRetryMaxBackoff time.Duration
+	// An endpoint failing BreakerFailures times in a row is not used for
+	// BreakerCooldown
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	// CollectorTimeout limits the time a collector may spend on a scrape,
+	// CollectorTimeouts overrides it for single collectors.
+	CollectorTimeout  time.Duration
+	CollectorTimeouts map[string]time.Duration
+	// ScrapeTimeoutOffset is subtracted from the scrape timeout announced
+	// by Prometheus to leave time for rendering the response.
+	ScrapeTimeoutOffset time.Duration
+}
+
+// TimeoutFor returns the time budget of the named collector.
+func (c *ExporterConfig) TimeoutFor(collector string) time.Duration {
+	if timeout, found := c.CollectorTimeouts[collector]; found {
+		return timeout
+	}
+	return c.CollectorTimeout
+}
+
+// ParseCollectorTimeouts parses a comma-separated list of
+// collector=duration pairs, e.g. "snapshot=10s,etcd=3s".
+func ParseCollectorTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid collector timeout %q, expected collector=duration", item)
+		}
+		timeout, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid collector timeout %q: %v", item, err)
+		}
+		timeouts[strings.TrimSpace(parts[0])] = timeout
+	}
+	return timeouts, nil
+}
@@ -1,6 +1,151 @@
 package config
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	defaultEtcdPort = "2379"
+	defaultPrefix   = "/vitastor"
+)
+
 type VitastorConfig struct {
-	VitastorEtcdUrls []string `json:"etcd_address"`
-	VitastorPrefix   string   `json:"etcd_prefix"`
+	VitastorEtcdUrls EtcdAddress `json:"etcd_address"`
+	VitastorPrefix   string      `json:"etcd_prefix"`
+	EtcdCAFile       string      `json:"etcd_ca_file,omitempty"`
+	EtcdCertFile     string      `json:"etcd_cert_file,omitempty"`
+	EtcdKeyFile      string      `json:"etcd_key_file,omitempty"`
+	EtcdUsername     string      `json:"etcd_username,omitempty"`
+	EtcdPassword     string      `json:"etcd_password,omitempty"`
+	EtcdPasswordFile string      `json:"etcd_password_file,omitempty"`
+}
+
+// UseTLS reports whether etcd should be reached over TLS.
+func (c *VitastorConfig) UseTLS() bool {
+	return c.EtcdCAFile != "" || c.EtcdCertFile != ""
+}
+
+// HasCredentials reports whether the settings carry anything that proves the
+// identity of the exporter to etcd.
+func (c *VitastorConfig) HasCredentials() bool {
+	return c.EtcdUsername != "" || c.EtcdPassword != "" || c.EtcdPasswordFile != "" || c.EtcdCertFile != "" || c.EtcdKeyFile != ""
+}
+
+// Password returns the etcd password, reading it from EtcdPasswordFile if
+// that is set.
+func (c *VitastorConfig) Password() (string, error) {
+	if c.EtcdPasswordFile == "" {
+		return c.EtcdPassword, nil
+	}
+	password, err := os.ReadFile(c.EtcdPasswordFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+// EtcdAddress is the etcd_address setting of vitastor.conf. Vitastor accepts
+// it both as a list and as a single comma-separated string, with or without
+// scheme and with an optional API path such as /v3.
+type EtcdAddress []string
+
+func (a *EtcdAddress) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		var single string
+		if json.Unmarshal(data, &single) != nil {
+			return errors.New("etcd_address must be a string or a list of strings")
+		}
+		list = []string{single}
+	}
+	*a = ParseEtcdAddress(strings.Join(list, ","))
+	return nil
+}
+
+// ParseEtcdAddress splits a comma-separated list of etcd addresses, dropping
+// empty entries.
+func ParseEtcdAddress(s string) EtcdAddress {
+	var addrs EtcdAddress
+	for _, addr := range strings.Split(s, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Normalize brings the settings to the form the etcd client expects: every
+// address becomes scheme://host:port and the prefix gets a single leading
+// slash and no trailing one. Addresses without scheme use https if TLS is
+// configured and http otherwise.
+func (c *VitastorConfig) Normalize() error {
+	scheme := "http"
+	if c.UseTLS() {
+		scheme = "https"
+	}
+	urls := make(EtcdAddress, 0, len(c.VitastorEtcdUrls))
+	for _, addr := range c.VitastorEtcdUrls {
+		if strings.TrimSpace(addr) == "" {
+			continue
+		}
+		u, err := NormalizeEtcdUrl(addr, scheme)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return errors.New("no etcd address configured")
+	}
+	c.VitastorEtcdUrls = urls
+	c.VitastorPrefix = NormalizePrefix(c.VitastorPrefix)
+	return nil
+}
+
+// NormalizeEtcdUrl converts a single etcd_address entry, e.g.
+// "10.0.0.1:2379/v3", to a URL usable by the etcd client, e.g.
+// "http://10.0.0.1:2379". Any API path is dropped since the gRPC client does
+// not use it.
+func NormalizeEtcdUrl(addr string, defaultScheme string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if !strings.Contains(addr, "://") {
+		addr = defaultScheme + "://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid etcd address %q: %v", addr, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid etcd address %q: unsupported scheme %q", addr, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid etcd address %q: no host", addr)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultEtcdPort
+	}
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// NormalizePrefix returns prefix with a single leading slash and without a
+// trailing one, falling back to /vitastor if it is empty.
+func NormalizePrefix(prefix string) string {
+	var parts []string
+	for _, part := range strings.Split(prefix, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return defaultPrefix
+	}
+	return "/" + strings.Join(parts, "/")
 }
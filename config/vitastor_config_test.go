@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeEtcdAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "list",
+			config: `{"etcd_address": ["10.0.0.1:2379", "10.0.0.2:2379"]}`,
+			want:   []string{"http://10.0.0.1:2379", "http://10.0.0.2:2379"},
+		},
+		{
+			name:   "comma-separated string",
+			config: `{"etcd_address": "10.0.0.1:2379,10.0.0.2:2379"}`,
+			want:   []string{"http://10.0.0.1:2379", "http://10.0.0.2:2379"},
+		},
+		{
+			name:   "bare host",
+			config: `{"etcd_address": "etcd1"}`,
+			want:   []string{"http://etcd1:2379"},
+		},
+		{
+			name:   "api path",
+			config: `{"etcd_address": "10.0.0.1:2379/v3"}`,
+			want:   []string{"http://10.0.0.1:2379"},
+		},
+		{
+			name:   "https with tls",
+			config: `{"etcd_address": "https://etcd1:2379/v3", "etcd_ca_file": "/etc/vitastor/ca.crt"}`,
+			want:   []string{"https://etcd1:2379"},
+		},
+		{
+			name:   "no scheme with tls",
+			config: `{"etcd_address": "etcd1:2379", "etcd_ca_file": "/etc/vitastor/ca.crt"}`,
+			want:   []string{"https://etcd1:2379"},
+		},
+		{
+			name:   "ipv6",
+			config: `{"etcd_address": "[::1]:2379/v3"}`,
+			want:   []string{"http://[::1]:2379"},
+		},
+		{
+			name:   "ipv6 without port",
+			config: `{"etcd_address": "http://[::1]/v3"}`,
+			want:   []string{"http://[::1]:2379"},
+		},
+		{
+			name:   "empty entries",
+			config: `{"etcd_address": ["", " 10.0.0.1:2379 ,,", "10.0.0.2:2379"]}`,
+			want:   []string{"http://10.0.0.1:2379", "http://10.0.0.2:2379"},
+		},
+		{
+			name:    "only empty entries",
+			config:  `{"etcd_address": ", ,"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported scheme",
+			config:  `{"etcd_address": "unix:///run/etcd.sock"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not a string",
+			config:  `{"etcd_address": 2379}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conf VitastorConfig
+			err := json.Unmarshal([]byte(tt.config), &conf)
+			if err == nil {
+				err = conf.Normalize()
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", conf.VitastorEtcdUrls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual([]string(conf.VitastorEtcdUrls), tt.want) {
+				t.Errorf("got %v, want %v", conf.VitastorEtcdUrls, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"", "/vitastor"},
+		{"/", "/vitastor"},
+		{"/vitastor", "/vitastor"},
+		{"vitastor", "/vitastor"},
+		{"/vitastor/", "/vitastor"},
+		{"//cluster1//vitastor/", "/cluster1/vitastor"},
+	}
+	for _, tt := range tests {
+		if got := NormalizePrefix(tt.prefix); got != tt.want {
+			t.Errorf("NormalizePrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -17,3 +17,21 @@ type ImageStats struct {
 	Iops  json.Number `json:"iops,omitempty"`
 	Lat   json.Number `json:"lat,omitempty"`
 }
+
+// VitastorImageConfig is the configuration of an image from
+// /config/inode/<pool>/<inode>. ParentPool is 0 if the parent is in the same
+// pool.
+type VitastorImageConfig struct {
+	Name       string `json:"name"`
+	Size       uint64 `json:"size"`
+	ParentPool uint64 `json:"parent_pool,omitempty"`
+	ParentId   uint64 `json:"parent_id,omitempty"`
+	Readonly   bool   `json:"readonly,omitempty"`
+}
+
+// VitastorImageIndex is the /index/image/<name> entry pointing from an image
+// name to its inode.
+type VitastorImageIndex struct {
+	Id     uint64 `json:"id"`
+	PoolId uint64 `json:"pool_id"`
+}
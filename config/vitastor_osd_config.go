@@ -1,5 +1,10 @@
 package config
 
+import (
+	"encoding/json"
+	"errors"
+)
+
 type VitastorOSDState struct {
 	Addresses         []string `json:"addresses"`
 	BlockstoreEnabled bool     `json:"blockstore_enabled"`
@@ -26,3 +31,43 @@ type OSDStats struct {
 	Count int `json:"count,omitempty"`
 	Usec  int `json:"usec,omitempty"`
 }
+
+// VitastorOSDConfig holds admin settings of an OSD from /config/osd/<n>.
+type VitastorOSDConfig struct {
+	Reweight *float64 `json:"reweight,omitempty"`
+	Tags     OSDTags  `json:"tags,omitempty"`
+	NoOut    bool     `json:"noout,omitempty"`
+}
+
+// GetReweight returns the reweight of the OSD, 1 if it is not set.
+func (c *VitastorOSDConfig) GetReweight() float64 {
+	if c.Reweight == nil {
+		return 1
+	}
+	return *c.Reweight
+}
+
+// OSDTags is a list of OSD tags. Like the monitor, it accepts either a list
+// or a single tag.
+type OSDTags []string
+
+func (t *OSDTags) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		var single string
+		if json.Unmarshal(data, &single) != nil {
+			return errors.New("tags must be a string or a list of strings")
+		}
+		list = []string{single}
+	}
+	*t = list
+	return nil
+}
+
+// VitastorOSDInodeStats are IO counters of one inode on one OSD. An
+// /osd/inodestats/<n> key maps pool ids to inode numbers to these.
+type VitastorOSDInodeStats struct {
+	Read   OSDStats `json:"read"`
+	Write  OSDStats `json:"write"`
+	Delete OSDStats `json:"delete"`
+}
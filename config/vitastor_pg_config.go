@@ -0,0 +1,34 @@
+package config
+
+type VitastorPGState struct {
+	Primary uint64   `json:"primary"`
+	State   []string `json:"state"`
+	Peers   []uint64 `json:"peers"`
+}
+
+type VitastorPGStats struct {
+	ObjectCount     uint64   `json:"object_count"`
+	CleanCount      uint64   `json:"clean_count"`
+	MisplacedCount  uint64   `json:"misplaced_count"`
+	DegradedCount   uint64   `json:"degraded_count"`
+	IncompleteCount uint64   `json:"incomplete_count"`
+	WriteOSDSet     []uint64 `json:"write_osd_set"`
+}
+
+type VitastorPGHistory struct {
+	Epoch    uint64     `json:"epoch"`
+	OSDSets  [][]uint64 `json:"osd_sets"`
+	AllPeers []uint64   `json:"all_peers"`
+}
+
+// VitastorPGConfig is /config/pgs, the OSD sets the monitor assigned to PGs.
+// Items maps pool ids to PG numbers.
+type VitastorPGConfig struct {
+	Items map[string]map[string]VitastorPGConfigItem `json:"items"`
+}
+
+type VitastorPGConfigItem struct {
+	OSDSet  []uint64 `json:"osd_set"`
+	Primary uint64   `json:"primary"`
+	Pause   bool     `json:"pause,omitempty"`
+}
@@ -0,0 +1,6 @@
+package config
+
+type VitastorNodePlacement struct {
+	Level  string `json:"level,omitempty"`
+	Parent string `json:"parent,omitempty"`
+}
@@ -0,0 +1,205 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	cacheProgressInterval = 5 * time.Second
+	cacheRetryInterval    = time.Second
+	cacheStaleAfter       = 3 * cacheProgressInterval
+)
+
+// stateCache keeps an in-memory copy of the Vitastor subtree in etcd. It
+// loads the whole prefix once and then follows it with a watch, so collectors
+// render metrics from memory and a scrape never waits for etcd.
+type stateCache struct {
+	etcd           *etcdClient
+	prefix         string
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+
+	mu       sync.RWMutex
+	kvs      map[string]*mvccpb.KeyValue
+	revision int64
+	synced   bool
+	lastSeen time.Time
+	reloads  float64
+
+	revisionDesc  *prometheus.Desc
+	syncedDesc    *prometheus.Desc
+	stalenessDesc *prometheus.Desc
+	reloadsDesc   *prometheus.Desc
+}
+
+func newStateCache(prefix string, etcd *etcdClient, exporterConfig *config.ExporterConfig, logger *log.Entry) *stateCache {
+	return &stateCache{
+		etcd:           etcd,
+		prefix:         prefix + "/",
+		exporterConfig: exporterConfig,
+		logger:         logger,
+		kvs:            make(map[string]*mvccpb.KeyValue),
+		revisionDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "cache_revision"),
+			"etcd revision the state cache is current at",
+			nil,
+			nil),
+		syncedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "cache_synced"),
+			"1 if the state cache is loaded and its watch is running, 0 otherwise",
+			nil,
+			nil),
+		stalenessDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "cache_staleness_seconds"),
+			"Seconds since etcd last confirmed the state cache is up to date",
+			nil,
+			nil),
+		reloadsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "cache_reloads_total"),
+			"Number of full reloads of the state cache",
+			nil,
+			nil),
+	}
+}
+
+// run keeps the cache in sync until ctx is cancelled.
+func (c *stateCache) run(ctx context.Context) {
+	for {
+		err := c.sync(ctx)
+		c.mu.Lock()
+		c.synced = false
+		c.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		c.logger.Error(err, "State cache lost sync with etcd, reloading")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cacheRetryInterval):
+		}
+	}
+}
+
+// sync loads the prefix and applies watch events until the watch breaks.
+func (c *stateCache) sync(ctx context.Context) error {
+	loadCtx, cancel := context.WithTimeout(ctx, c.exporterConfig.TimeoutFor("snapshot"))
+	resp, err := c.etcd.Get(loadCtx, c.prefix, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return err
+	}
+	kvs := make(map[string]*mvccpb.KeyValue, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = kv
+	}
+	c.mu.Lock()
+	c.kvs = kvs
+	c.revision = resp.Header.Revision
+	c.synced = true
+	c.lastSeen = time.Now()
+	c.reloads++
+	c.mu.Unlock()
+
+	cli, err := c.etcd.client(ctx)
+	if err != nil {
+		return err
+	}
+	wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	wch := cli.Watch(wctx, c.prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	ticker := time.NewTicker(cacheProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			// Progress notifications stop coming if the endpoint hangs
+			// without breaking the connection
+			c.mu.RLock()
+			stale := time.Since(c.lastSeen) > cacheStaleAfter
+			c.mu.RUnlock()
+			if stale {
+				c.etcd.failover(cli)
+				return errors.New("etcd watch stopped responding")
+			}
+			if err := cli.RequestProgress(wctx); err != nil {
+				c.logger.Debug(err, "Unable to request watch progress")
+			}
+		case wresp, ok := <-wch:
+			if !ok {
+				c.etcd.failover(cli)
+				return errors.New("etcd watch channel closed")
+			}
+			if err := wresp.Err(); err != nil {
+				if isConnectionError(err) || isAuthError(err) {
+					c.etcd.failover(cli)
+				}
+				return err
+			}
+			c.apply(&wresp)
+		}
+	}
+}
+
+func (c *stateCache) apply(wresp *clientv3.WatchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ev := range wresp.Events {
+		switch ev.Type {
+		case clientv3.EventTypePut:
+			c.kvs[string(ev.Kv.Key)] = ev.Kv
+		case clientv3.EventTypeDelete:
+			delete(c.kvs, string(ev.Kv.Key))
+		}
+	}
+	if wresp.Header.Revision > c.revision {
+		c.revision = wresp.Header.Revision
+	}
+	c.lastSeen = time.Now()
+}
+
+// snapshot returns a copy of the cache at its current revision.
+func (c *stateCache) snapshot(ctx context.Context) (*snapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.synced {
+		return nil, &stageError{stage: stageConnect, err: errors.New("state cache is not synced with etcd yet")}
+	}
+	kvs := make(map[string]*mvccpb.KeyValue, len(c.kvs))
+	for key, kv := range c.kvs {
+		kvs[key] = kv
+	}
+	return &snapshot{
+		revision: c.revision,
+		kvs:      kvs,
+	}, nil
+}
+
+func (c *stateCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.revisionDesc
+	ch <- c.syncedDesc
+	ch <- c.stalenessDesc
+	ch <- c.reloadsDesc
+}
+
+func (c *stateCache) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	synced := 0.0
+	if c.synced {
+		synced = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.revisionDesc, prometheus.GaugeValue, float64(c.revision))
+	ch <- prometheus.MustNewConstMetric(c.syncedDesc, prometheus.GaugeValue, synced)
+	if !c.lastSeen.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.stalenessDesc, prometheus.GaugeValue, time.Since(c.lastSeen).Seconds())
+	}
+	ch <- prometheus.MustNewConstMetric(c.reloadsDesc, prometheus.CounterValue, c.reloads)
+}
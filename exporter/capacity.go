@@ -0,0 +1,214 @@
+package exporter
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+// capacityOsd is an OSD data of a pool may be placed on.
+type capacityOsd struct {
+	name   string
+	domain string
+	free   float64
+	weight float64
+}
+
+// clusterLayout is what capacity calculations need to know about OSDs and
+// PGs of the cluster.
+type clusterLayout struct {
+	tree      *placementTree
+	osdStats  map[string]config.VitastorOSDStats
+	osdConfig map[string]config.VitastorOSDConfig
+	pgConfig  config.VitastorPGConfig
+}
+
+// loadClusterLayout reads OSD stats and configs, node placement and PG
+// assignments. Keys that fail to parse are skipped and the last parse error
+// is returned along with the layout.
+func loadClusterLayout(snap *snapshot, prefix string) (*clusterLayout, error) {
+	tree, osdStats, parseErr := buildPlacementTree(snap, prefix)
+	layout := &clusterLayout{
+		tree:      tree,
+		osdStats:  osdStats,
+		osdConfig: make(map[string]config.VitastorOSDConfig),
+	}
+	osdConfigPath := prefix + "/config/osd/"
+	for _, v := range snap.list(osdConfigPath) {
+		var conf config.VitastorOSDConfig
+		err := json.Unmarshal(v.Value, &conf)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+		layout.osdConfig[strings.TrimPrefix(string(v.Key), osdConfigPath)] = conf
+	}
+	pgConfigRaw := snap.get(prefix + "/config/pgs")
+	if pgConfigRaw != nil {
+		err := json.Unmarshal(pgConfigRaw.Value, &layout.pgConfig)
+		if err != nil {
+			parseErr = err
+		}
+	}
+	return layout, parseErr
+}
+
+// dataChunks returns the number of chunks of a PG that hold data rather than
+// redundancy.
+func dataChunks(pool *config.VitastorPoolConfig) int {
+	if pool.Scheme == "replicated" || pool.Scheme == "" {
+		return 1
+	}
+	return int(pool.PGSize - pool.ParityChunks)
+}
+
+// failureDomain returns the placement level PG chunks of the pool must be
+// spread over.
+func failureDomain(pool *config.VitastorPoolConfig) string {
+	if pool.FailureDomain == "" {
+		return "host"
+	}
+	return pool.FailureDomain
+}
+
+// poolOsds returns the OSDs of the pool: those carrying all of its tags and
+// not reweighted to 0.
+func (l *clusterLayout) poolOsds(pool *config.VitastorPoolConfig) []capacityOsd {
+	var osds []capacityOsd
+	for _, osd := range l.tree.osds {
+		stats, found := l.osdStats[osd]
+		if !found {
+			continue
+		}
+		conf := l.osdConfig[osd]
+		if !hasTags(conf.Tags, pool.OSDTags) {
+			continue
+		}
+		weight := float64(stats.Size) * conf.GetReweight()
+		if weight <= 0 {
+			continue
+		}
+		osds = append(osds, capacityOsd{
+			name:   osd,
+			domain: l.tree.ancestor(osd, failureDomain(pool)),
+			free:   float64(stats.Free),
+			weight: weight,
+		})
+	}
+	return osds
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, t := range tags {
+			if t == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// poolAvailable returns how many more usable bytes fit in the pool.
+//
+// If the monitor has already assigned OSDs to the PGs of the pool, this is
+// what vitastor-cli df reports: the pool is full once any of its OSDs is,
+// and every OSD fills at the rate of the number of PGs it holds. Otherwise
+// data is expected to spread over the pool's OSDs by their reweighted size,
+// with no failure domain holding more than one chunk of each PG.
+func (l *clusterLayout) poolAvailable(pool_id string, pool *config.VitastorPoolConfig) float64 {
+	if pgs := l.pgConfig.Items[pool_id]; len(pgs) > 0 {
+		pgPerOsd := make(map[uint64]int)
+		for _, pg := range pgs {
+			for _, osd := range pg.OSDSet {
+				if osd != 0 {
+					pgPerOsd[osd]++
+				}
+			}
+		}
+		available := math.Inf(1)
+		for osd, count := range pgPerOsd {
+			free := float64(l.osdStats[strconv.FormatUint(osd, 10)].Free)
+			available = math.Min(available, free*float64(len(pgs))/float64(count))
+		}
+		if math.IsInf(available, 1) {
+			return 0
+		}
+		return available * float64(dataChunks(pool))
+	}
+
+	if pool.PGSize <= 0 {
+		return 0
+	}
+	shares := spreadShares(l.poolOsds(pool), int(pool.PGSize))
+	if shares == nil {
+		return 0
+	}
+	raw := math.Inf(1)
+	for osd, share := range shares {
+		if share > 0 {
+			raw = math.Min(raw, osd.free/share)
+		}
+	}
+	if math.IsInf(raw, 1) {
+		return 0
+	}
+	return raw * float64(dataChunks(pool)) / float64(pool.PGSize)
+}
+
+// spreadShares returns the share of raw pool data each OSD gets when chunks
+// are spread by weight and each failure domain holds at most 1/pgSize of
+// them. It returns nil if there are fewer failure domains than pgSize.
+func spreadShares(osds []capacityOsd, pgSize int) map[capacityOsd]float64 {
+	domainWeight := make(map[string]float64)
+	for _, osd := range osds {
+		domainWeight[osd.domain] += osd.weight
+	}
+	if len(domainWeight) < pgSize {
+		return nil
+	}
+
+	// Domains too heavy for their share are capped, and the rest is spread
+	// over the others until no domain exceeds the cap
+	maxShare := 1 / float64(pgSize)
+	domainShare := make(map[string]float64)
+	remaining := 1.0
+	for {
+		total := 0.0
+		for domain, weight := range domainWeight {
+			if _, capped := domainShare[domain]; !capped {
+				total += weight
+			}
+		}
+		changed := false
+		for domain, weight := range domainWeight {
+			if _, capped := domainShare[domain]; !capped && remaining*weight/total > maxShare {
+				domainShare[domain] = maxShare
+				remaining -= maxShare
+				changed = true
+			}
+		}
+		if !changed {
+			for domain, weight := range domainWeight {
+				if _, capped := domainShare[domain]; !capped {
+					domainShare[domain] = remaining * weight / total
+				}
+			}
+			break
+		}
+	}
+
+	shares := make(map[capacityOsd]float64, len(osds))
+	for _, osd := range osds {
+		shares[osd] = domainShare[osd.domain] * osd.weight / domainWeight[osd.domain]
+	}
+	return shares
+}
@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"math"
+	"testing"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+type testOsd struct {
+	name string
+	host string
+	size int
+	free int
+}
+
+// testLayout builds a layout with every OSD up under its host and no
+// /config/osd entries.
+func testLayout(osds []testOsd, pgs map[string]map[string]config.VitastorPGConfigItem) *clusterLayout {
+	layout := &clusterLayout{
+		tree:      &placementTree{nodes: make(map[string]*placementNode)},
+		osdStats:  make(map[string]config.VitastorOSDStats),
+		osdConfig: make(map[string]config.VitastorOSDConfig),
+		pgConfig:  config.VitastorPGConfig{Items: pgs},
+	}
+	for _, osd := range osds {
+		layout.tree.nodes[osd.name] = &placementNode{name: osd.name, level: "osd", parent: osd.host}
+		layout.tree.nodes[osd.host] = &placementNode{name: osd.host, level: "host"}
+		layout.tree.osds = append(layout.tree.osds, osd.name)
+		layout.osdStats[osd.name] = config.VitastorOSDStats{Host: osd.host, Size: osd.size, Free: osd.free}
+	}
+	return layout
+}
+
+func TestPoolAvailable(t *testing.T) {
+	threeHosts := []testOsd{
+		{"1", "h1", 1000, 600},
+		{"2", "h2", 1000, 700},
+		{"3", "h3", 2000, 1500},
+	}
+	cappedHost := []testOsd{
+		{"1", "h1", 1000, 1000},
+		{"2", "h2", 1000, 1000},
+		{"3", "h3", 4000, 4000},
+	}
+	assigned := map[string]map[string]config.VitastorPGConfigItem{
+		"1": {
+			"1": {OSDSet: []uint64{1, 2}},
+			"2": {OSDSet: []uint64{2, 3}},
+			"3": {OSDSet: []uint64{3, 1}},
+			"4": {OSDSet: []uint64{1, 3}},
+		},
+	}
+	assignedEc := map[string]map[string]config.VitastorPGConfigItem{
+		"1": {
+			"1": {OSDSet: []uint64{1, 2, 3}},
+			"2": {OSDSet: []uint64{2, 3, 1}},
+		},
+	}
+	tests := []struct {
+		name string
+		osds []testOsd
+		pgs  map[string]map[string]config.VitastorPGConfigItem
+		pool config.VitastorPoolConfig
+		want float64
+	}{
+		{
+			// Shares 1/4, 1/4, 1/2, OSD 1 fills first
+			name: "replicated",
+			osds: threeHosts,
+			pool: config.VitastorPoolConfig{Scheme: "replicated", PGSize: 2},
+			want: 1200,
+		},
+		{
+			// h3 is capped at 1/3, usable is 2/3 of raw
+			name: "ec",
+			osds: threeHosts,
+			pool: config.VitastorPoolConfig{Scheme: "ec", PGSize: 3, ParityChunks: 1},
+			want: 1200,
+		},
+		{
+			// h3 would get 2/3 by weight but holds at most 1/2
+			name: "capped failure domain",
+			osds: cappedHost,
+			pool: config.VitastorPoolConfig{Scheme: "replicated", PGSize: 2},
+			want: 2000,
+		},
+		{
+			name: "fewer domains than pg_size",
+			osds: threeHosts,
+			pool: config.VitastorPoolConfig{Scheme: "replicated", PGSize: 4},
+			want: 0,
+		},
+		{
+			// OSD 1 holds 3 of 4 PGs: 600 * 4 / 3
+			name: "assigned pgs",
+			osds: threeHosts,
+			pgs:  assigned,
+			pool: config.VitastorPoolConfig{Scheme: "replicated", PGSize: 2},
+			want: 800,
+		},
+		{
+			// Every OSD holds both PGs, OSD 1 fills first with 600 raw
+			// bytes per PG chunk and 2 data chunks per PG
+			name: "assigned pgs ec",
+			osds: threeHosts,
+			pgs:  assignedEc,
+			pool: config.VitastorPoolConfig{Scheme: "ec", PGSize: 3, ParityChunks: 1},
+			want: 1200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := testLayout(tt.osds, tt.pgs)
+			got := layout.poolAvailable("1", &tt.pool)
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpreadShares(t *testing.T) {
+	osds := []capacityOsd{
+		{name: "1", domain: "h1", weight: 1000},
+		{name: "2", domain: "h1", weight: 1000},
+		{name: "3", domain: "h2", weight: 1000},
+		{name: "4", domain: "h3", weight: 6000},
+	}
+	if shares := spreadShares(osds, 4); shares != nil {
+		t.Errorf("expected no shares with fewer domains than pg_size, got %v", shares)
+	}
+
+	shares := spreadShares(osds, 2)
+	want := map[string]float64{"1": 1.0 / 6, "2": 1.0 / 6, "3": 1.0 / 6, "4": 0.5}
+	total := 0.0
+	for osd, share := range shares {
+		total += share
+		if math.Abs(share-want[osd.name]) > 1e-9 {
+			t.Errorf("share of OSD %s is %v, want %v", osd.name, share, want[osd.name])
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("shares add up to %v", total)
+	}
+}
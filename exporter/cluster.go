@@ -0,0 +1,128 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// vitastorCollector renders one group of metrics from a snapshot of the
+// Vitastor tree.
+type vitastorCollector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	// name is the value of the collector label of the exporter's own
+	// metrics.
+	name() string
+	// paths lists the keys the collector reads, relative to the Vitastor
+	// prefix. Paths ending with "/" are prefixes.
+	paths() []string
+	// collect renders the metrics of the snapshot. It keeps going past
+	// entries it can not parse and returns the last parse error. Collectors
+	// querying etcd on their own bound their queries by ctx, the context
+	// of the scrape, and return a stageError for failed queries.
+	collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error
+}
+
+// clusterCollector takes one snapshot per scrape and hands it to every
+// collector of the cluster.
+type clusterCollector struct {
+	revision *prometheus.Desc
+	duration *prometheus.Desc
+	success  *prometheus.Desc
+	errors   *prometheus.CounterVec
+
+	source         snapshotSource
+	collectors     []vitastorCollector
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+}
+
+func newClusterCollector(source snapshotSource, collectors []vitastorCollector, exporterConfig *config.ExporterConfig, logger *log.Entry) *clusterCollector {
+	errors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: prometheus.BuildFQName(namespace, "exporter", "errors_total"),
+		Help: "Number of scrapes a collector failed, by the stage it failed at",
+	}, []string{"collector", "stage"})
+	for _, c := range collectors {
+		for _, stage := range scrapeStages {
+			errors.WithLabelValues(c.name(), stage)
+		}
+	}
+	return &clusterCollector{
+		revision: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "revision"),
+			"etcd revision the metrics of this scrape were read at",
+			nil,
+			nil),
+		duration: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "collector_duration_seconds"),
+			"Time the collector took to render its metrics, including reading the Vitastor tree, in seconds",
+			[]string{"collector"},
+			nil),
+		success: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "collector_success"),
+			"1 if the collector rendered its metrics without errors, 0 otherwise",
+			[]string{"collector"},
+			nil),
+		errors:         errors,
+		source:         source,
+		collectors:     collectors,
+		exporterConfig: exporterConfig,
+		logger:         logger,
+	}
+}
+
+// collectorPaths returns the paths read by all given collectors.
+func collectorPaths(collectors []vitastorCollector) []string {
+	var paths []string
+	for _, c := range collectors {
+		paths = append(paths, c.paths()...)
+	}
+	return paths
+}
+
+func (collector *clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.revision
+	ch <- collector.duration
+	ch <- collector.success
+	collector.errors.Describe(ch)
+	for _, c := range collector.collectors {
+		c.Describe(ch)
+	}
+}
+
+func (collector *clusterCollector) collectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	defer collector.errors.Collect(ch)
+	start := time.Now()
+	snapCtx, cancel := context.WithTimeout(ctx, collector.exporterConfig.TimeoutFor("snapshot"))
+	snap, err := collector.source.snapshot(snapCtx)
+	cancel()
+	snapshotDuration := time.Since(start)
+	if err != nil {
+		collector.logger.Error(err, "Unable to get snapshot of vitastor tree")
+		stage := errorStage(err)
+		for _, c := range collector.collectors {
+			collector.errors.WithLabelValues(c.name(), stage).Inc()
+			ch <- prometheus.MustNewConstMetric(collector.duration, prometheus.GaugeValue, snapshotDuration.Seconds(), c.name())
+			ch <- prometheus.MustNewConstMetric(collector.success, prometheus.GaugeValue, 0, c.name())
+		}
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.revision, prometheus.GaugeValue, float64(snap.revision))
+	for _, c := range collector.collectors {
+		start := time.Now()
+		err := c.collect(ctx, snap, ch)
+		success := 1.0
+		if err != nil {
+			stage := stageParse
+			var se *stageError
+			if errors.As(err, &se) {
+				stage = se.stage
+			}
+			collector.errors.WithLabelValues(c.name(), stage).Inc()
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(collector.duration, prometheus.GaugeValue, (snapshotDuration + time.Since(start)).Seconds(), c.name())
+		ch <- prometheus.MustNewConstMetric(collector.success, prometheus.GaugeValue, success, c.name())
+	}
+}
@@ -0,0 +1,45 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// ctxCollector records the error of the context it is given.
+type ctxCollector struct {
+	ctxErr error
+}
+
+func (c *ctxCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *ctxCollector) name() string {
+	return "ctx"
+}
+
+func (c *ctxCollector) paths() []string {
+	return nil
+}
+
+func (c *ctxCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	c.ctxErr = ctx.Err()
+	return nil
+}
+
+func TestClusterCollectorContext(t *testing.T) {
+	c := &ctxCollector{}
+	exporterConfig := &config.ExporterConfig{CollectorTimeout: time.Second}
+	collector := newClusterCollector(&fixedSource{snap: &snapshot{}}, []vitastorCollector{c}, exporterConfig, log.NewEntry(log.StandardLogger()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ch := make(chan prometheus.Metric, 16)
+	collector.collectContext(ctx, ch)
+	if c.ctxErr != nil {
+		t.Errorf("collector got a done context: %v", c.ctxErr)
+	}
+}
@@ -1,27 +1,69 @@
 package exporter
 
 import (
+	"context"
+
 	config "github.com/Antilles7227/vitastor-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/common/version"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
 	namespace = "vitastor"
 )
 
-func Register(config *config.VitastorConfig) {
-	poolCollector := newPoolCollector(config)
-	monitorCollector := newMonitorCollector(config)
-	osdCollector := newOsdCollector(config)
-	statsCollector := newStatsCollector(config)
-	imageCollector := newImageCollector(config)
+func Register(clusters []config.ClusterConfig, exporterConfig *config.ExporterConfig) {
 	prometheus.MustRegister(version.NewCollector("vitastor_exporter"))
-	prometheus.MustRegister(poolCollector)
-	prometheus.MustRegister(monitorCollector)
-	prometheus.MustRegister(osdCollector)
-	prometheus.MustRegister(statsCollector)
-	prometheus.MustRegister(imageCollector)
+	for i := range clusters {
+		registerCluster(&clusters[i], exporterConfig)
+	}
 	prometheus.Unregister(collectors.NewGoCollector())
 }
+
+// registerCluster sets up the etcd connection and collectors of one cluster.
+// Every cluster gets its own connection and its metrics carry a cluster label,
+// so a failing cluster does not affect the others.
+func registerCluster(cluster *config.ClusterConfig, exporterConfig *config.ExporterConfig) {
+	conf := &cluster.VitastorConfig
+	logger := log.WithField("cluster", cluster.Name)
+	labels := prometheus.Labels{"cluster": cluster.Name}
+	registerer := prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer)
+
+	etcd := newEtcdClient(conf, exporterConfig, logger)
+	vitastorCollectors := newVitastorCollectors(conf, exporterConfig, etcd, logger)
+	var source snapshotSource
+	if exporterConfig.EtcdWatch {
+		cache := newStateCache(conf.VitastorPrefix, etcd, exporterConfig, logger)
+		go cache.run(context.Background())
+		registerer.MustRegister(cache)
+		source = cache
+	} else {
+		source = newEtcdReader(conf.VitastorPrefix, etcd, collectorPaths(vitastorCollectors))
+	}
+	registerScrapeCollector(labels, newClusterCollector(source, vitastorCollectors, exporterConfig, logger))
+	registerScrapeCollector(labels, newEtcdCollector(conf, exporterConfig, etcd, logger))
+}
+
+// newVitastorCollectors creates the collectors rendering metrics of a cluster.
+func newVitastorCollectors(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, etcd *etcdClient, logger *log.Entry) []vitastorCollector {
+	return []vitastorCollector{
+		newPoolCollector(conf, logger),
+		newMonitorCollector(conf, logger),
+		newOsdCollector(conf, logger),
+		newStatsCollector(conf, logger),
+		newImageCollector(conf, logger),
+		newPgCollector(conf, exporterConfig, logger),
+		newOsdConfigCollector(conf, logger),
+		newPlacementCollector(conf, logger),
+		newOsdInodeCollector(conf, exporterConfig, logger),
+		newOsdSpaceCollector(conf, exporterConfig, logger),
+		newGlobalConfigCollector(conf, logger),
+		newIndexCollector(conf, logger),
+		newLeaseCollector(conf, exporterConfig, etcd, logger),
+		newFailureDomainCollector(conf, logger),
+		newRecoveryCollector(conf, exporterConfig, logger),
+		newImageChainCollector(conf, logger),
+	}
+}
@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"errors"
+)
+
+// Stages a scrape may fail at, used as the stage label of the error counter.
+const (
+	stageConnect = "connect"
+	stageFetch   = "fetch"
+	stageParse   = "parse"
+)
+
+var scrapeStages = []string{stageConnect, stageFetch, stageParse}
+
+// stageError marks an error with the stage it happened at.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// errorStage tells whether reading the Vitastor tree failed while connecting
+// to etcd or while fetching the keys.
+func errorStage(err error) string {
+	var se *stageError
+	if errors.As(err, &se) {
+		return se.stage
+	}
+	if isConnectionError(err) || isAuthError(err) {
+		return stageConnect
+	}
+	return stageFetch
+}
@@ -0,0 +1,292 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// etcdClient is the etcd connection shared by all collectors of a cluster.
+// It talks to one endpoint at a time and fails over to the next one when a
+// request fails with a connection error. Failed requests are retried with
+// jittered exponential backoff, and an endpoint failing several times in a
+// row is skipped for a while by a circuit breaker.
+type etcdClient struct {
+	mu        sync.Mutex
+	cli       *clientv3.Client
+	current   int
+	next      int
+	endpoints []string
+	breakers  []endpointBreaker
+
+	// tlsMu guards tls apart from mu, which is held during dials
+	tlsMu sync.Mutex
+	tls   *tlsReloader
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+}
+
+type endpointBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+var errBreakerOpen = errors.New("all etcd endpoints are unavailable, circuit breaker is open")
+
+func newEtcdClient(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, logger *log.Entry) *etcdClient {
+	endpoints := make([]string, 0, len(conf.VitastorEtcdUrls))
+	for _, url := range conf.VitastorEtcdUrls {
+		if url != "" {
+			endpoints = append(endpoints, url)
+		}
+	}
+	return &etcdClient{
+		endpoints:      endpoints,
+		breakers:       make([]endpointBreaker, len(endpoints)),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		logger:         logger,
+	}
+}
+
+// client returns the current connection. If there is none, it dials the
+// next endpoint whose circuit breaker is closed, giving up when ctx expires.
+func (c *etcdClient) client(ctx context.Context) (*clientv3.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cli != nil {
+		return c.cli, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.endpoints) == 0 {
+		return nil, &stageError{stage: stageConnect, err: errors.New("no etcd endpoints configured")}
+	}
+	now := time.Now()
+	for i := range c.endpoints {
+		idx := (c.next + i) % len(c.endpoints)
+		if c.breakers[idx].openUntil.After(now) {
+			continue
+		}
+		c.next = (idx + 1) % len(c.endpoints)
+		cli, err := c.dial(ctx, c.endpoints[idx])
+		if err != nil {
+			// A dial cut short by the caller's deadline says nothing
+			// about the endpoint
+			if ctx.Err() == nil {
+				c.recordFailure(idx)
+			}
+			return nil, &stageError{stage: stageConnect, err: err}
+		}
+		c.cli = cli
+		c.current = idx
+		return cli, nil
+	}
+	return nil, &stageError{stage: stageConnect, err: errBreakerOpen}
+}
+
+// dial connects to a single endpoint. Callers must hold mu.
+func (c *etcdClient) dial(ctx context.Context, endpoint string) (*clientv3.Client, error) {
+	etcdConfig, err := c.clientConfig(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(etcdConfig)
+}
+
+// dialEndpoint connects to the given endpoint, bypassing failover and
+// circuit breakers. The caller closes the returned client.
+func (c *etcdClient) dialEndpoint(ctx context.Context, endpoint string) (*clientv3.Client, error) {
+	etcdConfig, err := c.clientConfig(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(etcdConfig)
+}
+
+// clientConfig returns the settings of a connection to a single endpoint.
+func (c *etcdClient) clientConfig(ctx context.Context, endpoint string) (clientv3.Config, error) {
+	dialTimeout := c.exporterConfig.EtcdDialTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < dialTimeout {
+		dialTimeout = time.Until(deadline)
+	}
+	// clientv3 treats a zero timeout as no timeout at all
+	if dialTimeout <= 0 {
+		return clientv3.Config{}, context.DeadlineExceeded
+	}
+	etcdConfig := clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: dialTimeout,
+		// Block until connected so an unreachable endpoint fails the dial
+		// instead of every request made through it.
+		DialOptions: []grpc.DialOption{grpc.WithBlock()},
+	}
+	if c.vitastorConfig.UseTLS() {
+		reloader, err := c.loadTLS()
+		if err != nil {
+			return clientv3.Config{}, err
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return clientv3.Config{}, err
+		}
+		etcdConfig.TLS = reloader.config(u.Hostname())
+	}
+	if c.vitastorConfig.EtcdUsername != "" {
+		// Read the password on every dial so a rotated secret is picked up
+		// after the next authentication failure.
+		password, err := c.vitastorConfig.Password()
+		if err != nil {
+			return clientv3.Config{}, err
+		}
+		etcdConfig.Username = c.vitastorConfig.EtcdUsername
+		etcdConfig.Password = password
+	}
+	return etcdConfig, nil
+}
+
+// loadTLS returns the certificates of the cluster, loading them on first
+// use. Loading is retried on every dial until it succeeds.
+func (c *etcdClient) loadTLS() (*tlsReloader, error) {
+	c.tlsMu.Lock()
+	defer c.tlsMu.Unlock()
+	if c.tls == nil {
+		reloader, err := newTLSReloader(c.vitastorConfig.EtcdCAFile, c.vitastorConfig.EtcdCertFile, c.vitastorConfig.EtcdKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.tls = reloader
+	}
+	return c.tls, nil
+}
+
+// recordFailure counts a failure of the endpoint and opens its circuit
+// breaker if it failed too many times in a row. Callers must hold mu.
+func (c *etcdClient) recordFailure(idx int) {
+	breaker := &c.breakers[idx]
+	breaker.failures++
+	if c.exporterConfig.BreakerFailures > 0 && breaker.failures >= c.exporterConfig.BreakerFailures {
+		c.logger.Warn("etcd endpoint ", c.endpoints[idx], " failed ", breaker.failures, " times in a row, not using it for ", c.exporterConfig.BreakerCooldown)
+		breaker.openUntil = time.Now().Add(c.exporterConfig.BreakerCooldown)
+		breaker.failures = 0
+	}
+}
+
+// succeeded resets the failure count of the endpoint cli is connected to.
+func (c *etcdClient) succeeded(cli *clientv3.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cli == cli {
+		c.breakers[c.current].failures = 0
+	}
+}
+
+// failover drops a broken connection so the next request dials the next
+// endpoint. It is a no-op if another goroutine already replaced the
+// connection.
+func (c *etcdClient) failover(cli *clientv3.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cli != cli {
+		return
+	}
+	c.logger.Warn("Lost connection to etcd endpoint ", c.endpoints[c.current], ", failing over")
+	c.recordFailure(c.current)
+	c.cli.Close()
+	c.cli = nil
+}
+
+// backoff returns the jittered delay before the given retry.
+func (c *etcdClient) backoff(attempt int) time.Duration {
+	delay := c.exporterConfig.EtcdRetryBackoff << uint(attempt)
+	if delay <= 0 || delay > c.exporterConfig.EtcdRetryMaxBackoff {
+		delay = c.exporterConfig.EtcdRetryMaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Get reads keys from etcd, retrying failed attempts until the retries or
+// ctx run out.
+func (c *etcdClient) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.get(ctx, key, opts...)
+		if err == nil || errors.Is(err, errBreakerOpen) || attempt >= c.exporterConfig.EtcdRetries || ctx.Err() != nil {
+			return resp, err
+		}
+		if !(isConnectionError(err) || isAuthError(err)) {
+			return resp, err
+		}
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+func (c *etcdClient) get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, c.exporterConfig.EtcdRequestTimeout)
+	resp, err := cli.Get(attemptCtx, key, opts...)
+	cancel()
+	if err == nil {
+		c.succeeded(cli)
+	} else if ctx.Err() == nil && (isConnectionError(err) || isAuthError(err)) {
+		// Only the attempt timing out, not the caller giving up, counts
+		// against the endpoint
+		c.failover(cli)
+	}
+	return resp, err
+}
+
+func (c *etcdClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cli != nil {
+		c.cli.Close()
+		c.cli = nil
+	}
+}
+
+func isConnectionError(err error) bool {
+	var se *stageError
+	if errors.As(err, &se) && se.stage == stageConnect {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func isAuthError(err error) bool {
+	switch rpctypes.Error(err) {
+	case rpctypes.ErrAuthFailed, rpctypes.ErrInvalidAuthToken, rpctypes.ErrAuthOldRevision:
+		return true
+	}
+	return status.Code(err) == codes.Unauthenticated
+}
@@ -0,0 +1,185 @@
+package exporter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdCollector reports the health of the etcd cluster behind Vitastor. It
+// queries every configured endpoint directly, so it keeps working when the
+// Vitastor tree can not be read.
+type etcdCollector struct {
+	up          *prometheus.Desc
+	latency     *prometheus.Desc
+	memberInfo  *prometheus.Desc
+	isLeader    *prometheus.Desc
+	raftTerm    *prometheus.Desc
+	raftIndex   *prometheus.Desc
+	raftApplied *prometheus.Desc
+	dbSize      *prometheus.Desc
+	dbSizeInUse *prometheus.Desc
+	alarms      *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	etcd           *etcdClient
+	logger         *log.Entry
+}
+
+func newEtcdCollector(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, etcd *etcdClient, logger *log.Entry) *etcdCollector {
+	return &etcdCollector{
+		up: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "endpoint_up"),
+			"1 if etcd endpoint answered the status request, 0 otherwise",
+			[]string{"endpoint"},
+			nil),
+		latency: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "endpoint_latency_seconds"),
+			"Round-trip time of the status request to etcd endpoint in seconds",
+			[]string{"endpoint"},
+			nil),
+		memberInfo: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "member_info"),
+			"etcd member info",
+			[]string{"endpoint", "member_id", "leader_id", "version", "is_learner"},
+			nil),
+		isLeader: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "is_leader"),
+			"1 if etcd member is the raft leader, 0 otherwise",
+			[]string{"endpoint", "member_id"},
+			nil),
+		raftTerm: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "raft_term"),
+			"Current raft term of etcd member",
+			[]string{"endpoint", "member_id"},
+			nil),
+		raftIndex: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "raft_index"),
+			"Current raft committed index of etcd member",
+			[]string{"endpoint", "member_id"},
+			nil),
+		raftApplied: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "raft_applied_index"),
+			"Current raft applied index of etcd member",
+			[]string{"endpoint", "member_id"},
+			nil),
+		dbSize: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "db_size_bytes"),
+			"Size of etcd database physically allocated in bytes",
+			[]string{"endpoint", "member_id"},
+			nil),
+		dbSizeInUse: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "db_size_in_use_bytes"),
+			"Size of etcd database logically in use in bytes",
+			[]string{"endpoint", "member_id"},
+			nil),
+		alarms: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "alarms"),
+			"Number of etcd members with the alarm active",
+			[]string{"alarm"},
+			nil),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		etcd:           etcd,
+		logger:         logger,
+	}
+}
+
+func (collector *etcdCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.up
+	ch <- collector.latency
+	ch <- collector.memberInfo
+	ch <- collector.isLeader
+	ch <- collector.raftTerm
+	ch <- collector.raftIndex
+	ch <- collector.raftApplied
+	ch <- collector.dbSize
+	ch <- collector.dbSizeInUse
+	ch <- collector.alarms
+}
+
+func (collector *etcdCollector) collectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(ctx, collector.exporterConfig.TimeoutFor("etcd"))
+	defer cancel()
+
+	// Every endpoint gets a connection of its own, so the state of one does
+	// not depend on whether the shared connection could reach another
+	var wg sync.WaitGroup
+	clients := make([]*clientv3.Client, len(collector.vitastorConfig.VitastorEtcdUrls))
+	for i, endpoint := range collector.vitastorConfig.VitastorEtcdUrls {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			clients[i] = collector.collectEndpoint(ctx, endpoint, ch)
+		}(i, endpoint)
+	}
+	wg.Wait()
+	var cli *clientv3.Client
+	for _, c := range clients {
+		if c == nil {
+			continue
+		}
+		defer c.Close()
+		if cli == nil {
+			cli = c
+		}
+	}
+	if cli == nil {
+		return
+	}
+
+	alarmsCtx, alarmsCancel := context.WithTimeout(ctx, collector.exporterConfig.EtcdRequestTimeout)
+	alarmsRaw, err := cli.AlarmList(alarmsCtx)
+	alarmsCancel()
+	if err != nil {
+		collector.logger.Error(err, "Unable to retrive etcd alarms")
+		return
+	}
+	alarms := map[string]int{
+		pb.AlarmType_NOSPACE.String(): 0,
+		pb.AlarmType_CORRUPT.String(): 0,
+	}
+	for _, alarm := range alarmsRaw.Alarms {
+		alarms[alarm.Alarm.String()]++
+	}
+	for alarm, count := range alarms {
+		ch <- prometheus.MustNewConstMetric(collector.alarms, prometheus.GaugeValue, float64(count), alarm)
+	}
+}
+
+// collectEndpoint connects to the endpoint and reports its status. It returns
+// the connection if the endpoint is up, nil otherwise.
+func (collector *etcdCollector) collectEndpoint(ctx context.Context, endpoint string, ch chan<- prometheus.Metric) *clientv3.Client {
+	cli, err := collector.etcd.dialEndpoint(ctx, endpoint)
+	if err != nil {
+		collector.logger.Warn(err, "etcd endpoint ", endpoint, " is down")
+		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 0, endpoint)
+		return nil
+	}
+	statusCtx, cancel := context.WithTimeout(ctx, collector.exporterConfig.EtcdRequestTimeout)
+	start := time.Now()
+	status, err := cli.Status(statusCtx, endpoint)
+	latency := time.Since(start)
+	cancel()
+	if err != nil {
+		collector.logger.Warn(err, "etcd endpoint ", endpoint, " is down")
+		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 0, endpoint)
+		cli.Close()
+		return nil
+	}
+	ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 1, endpoint)
+	ch <- prometheus.MustNewConstMetric(collector.latency, prometheus.GaugeValue, latency.Seconds(), endpoint)
+
+	memberId := strconv.FormatUint(status.Header.MemberId, 16)
+	leaderId := strconv.FormatUint(status.Leader, 16)
+	isLeader := 0.0
+	if status.Header.MemberId == status.Leader {
+		isLeader = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collector.memberInfo, prometheus.GaugeValue, 1, endpoint, memberId, leaderId, status.Version, strconv.FormatBool(status.IsLearner))
+	ch <- prometheus.MustNewConstMetric(collector.isLeader, prometheus.GaugeValue, isLeader, endpoint, memberId)
+	ch <- prometheus.MustNewConstMetric(collector.raftTerm, prometheus.GaugeValue, float64(status.RaftTerm), endpoint, memberId)
+	ch <- prometheus.MustNewConstMetric(collector.raftIndex, prometheus.GaugeValue, float64(status.RaftIndex), endpoint, memberId)
+	ch <- prometheus.MustNewConstMetric(collector.raftApplied, prometheus.GaugeValue, float64(status.RaftAppliedIndex), endpoint, memberId)
+	ch <- prometheus.MustNewConstMetric(collector.dbSize, prometheus.GaugeValue, float64(status.DbSize), endpoint, memberId)
+	ch <- prometheus.MustNewConstMetric(collector.dbSizeInUse, prometheus.GaugeValue, float64(status.DbSizeInUse), endpoint, memberId)
+	return cli
+}
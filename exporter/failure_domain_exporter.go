@@ -0,0 +1,208 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// failureDomainCollector tells for every pool how many hosts, or units of
+// the pool's failure domain, may fail before some PG drops below pg_minsize,
+// and whether the rest of the pool has room to rebuild the data of a failed
+// unit.
+type failureDomainCollector struct {
+	tolerated *prometheus.Desc
+	shortfall *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
+}
+
+func newFailureDomainCollector(conf *config.VitastorConfig, logger *log.Entry) *failureDomainCollector {
+	return &failureDomainCollector{
+		tolerated: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "failure_domains_tolerated"),
+			"Number of placement nodes of the level that may fail in the worst case with every PG of pool staying at or above pg_minsize",
+			[]string{"pool_name", "pool_id", "level"},
+			nil),
+		shortfall: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "rebuild_shortfall_bytes"),
+			"Raw bytes of pool that could not be rebuilt after the failure of the worst placement node of the level",
+			[]string{"pool_name", "pool_id", "level"},
+			nil),
+		vitastorConfig: conf,
+		logger:         logger,
+	}
+}
+
+func (collector *failureDomainCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.tolerated
+	ch <- collector.shortfall
+}
+
+func (collector *failureDomainCollector) name() string {
+	return "failure_domain"
+}
+
+func (collector *failureDomainCollector) paths() []string {
+	return []string{"/config/pools", "/config/pgs", "/config/osd/", "/config/node_placement", "/osd/stats/", "/osd/state/", "/osd/space/"}
+}
+
+func (collector *failureDomainCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	prefix := collector.vitastorConfig.VitastorPrefix
+	poolsConfigRaw := snap.get(prefix + "/config/pools")
+	if poolsConfigRaw == nil {
+		return nil
+	}
+	var pools map[string]config.VitastorPoolConfig
+	err := json.Unmarshal(poolsConfigRaw.Value, &pools)
+	if err != nil {
+		collector.logger.Error(err, "Unable to parse pools config block")
+		return err
+	}
+
+	layout, parseErr := loadClusterLayout(snap, prefix)
+	if parseErr != nil {
+		collector.logger.Error(parseErr, "Unable to parse cluster layout")
+	}
+
+	// Raw bytes every OSD holds for every pool
+	poolUsed := make(map[string]map[string]float64)
+	osdSpacePath := prefix + "/osd/space/"
+	for _, v := range snap.list(osdSpacePath) {
+		var space map[string]map[string]uint64
+		err := json.Unmarshal(v.Value, &space)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse osd space")
+			parseErr = err
+			continue
+		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdSpacePath)
+		for pool_id, images := range space {
+			if poolUsed[pool_id] == nil {
+				poolUsed[pool_id] = make(map[string]float64)
+			}
+			for _, used := range images {
+				poolUsed[pool_id][osd_num] += float64(used)
+			}
+		}
+	}
+
+	osdStatePath := prefix + "/osd/state/"
+	up := func(osd string) bool {
+		return snap.get(osdStatePath+osd) != nil
+	}
+
+	for id, pool := range pools {
+		levels := []string{"host"}
+		if domain := failureDomain(&pool); domain != "host" {
+			levels = append(levels, domain)
+		}
+		for _, level := range levels {
+			if pgs := layout.pgConfig.Items[id]; len(pgs) > 0 {
+				tolerated := toleratedFailures(pgs, int(pool.PGMinSize), func(osd string) string {
+					return layout.tree.ancestor(osd, level)
+				}, up)
+				ch <- prometheus.MustNewConstMetric(collector.tolerated, prometheus.GaugeValue, float64(tolerated), pool.Name, id, level)
+			}
+			shortfall := rebuildShortfall(layout.poolOsds(&pool), poolUsed[id], int(pool.PGSize), func(osd string) string {
+				return layout.tree.ancestor(osd, level)
+			}, up)
+			ch <- prometheus.MustNewConstMetric(collector.shortfall, prometheus.GaugeValue, shortfall, pool.Name, id, level)
+		}
+	}
+	return parseErr
+}
+
+// toleratedFailures returns how many nodes may fail, whichever they are,
+// with every PG keeping at least minSize live OSDs. The worst failures for a
+// PG are those of the nodes holding most of its live OSDs, so each PG loses
+// its nodes in that order until the next one would take it below minSize.
+func toleratedFailures(pgs map[string]config.VitastorPGConfigItem, minSize int, unit func(string) string, up func(string) bool) int {
+	if minSize < 1 {
+		minSize = 1
+	}
+	tolerated := -1
+	for _, pg := range pgs {
+		perUnit := make(map[string]int)
+		live := 0
+		for _, osd := range pg.OSDSet {
+			if osd == 0 {
+				continue
+			}
+			osd_num := strconv.FormatUint(osd, 10)
+			if !up(osd_num) {
+				continue
+			}
+			perUnit[unit(osd_num)]++
+			live++
+		}
+		counts := make([]int, 0, len(perUnit))
+		for _, count := range perUnit {
+			counts = append(counts, count)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+
+		failures := 0
+		for _, count := range counts {
+			if live-count < minSize {
+				break
+			}
+			live -= count
+			failures++
+		}
+		if tolerated < 0 || failures < tolerated {
+			tolerated = failures
+		}
+	}
+	if tolerated < 0 {
+		return 0
+	}
+	return tolerated
+}
+
+// rebuildShortfall returns the largest amount of pool data, over all nodes,
+// that would have nowhere to go if the node failed. Data is rebuilt on up
+// OSDs of the pool in other nodes, and only if there are still at least
+// pgSize such nodes to place every chunk in a different one.
+func rebuildShortfall(osds []capacityOsd, used map[string]float64, pgSize int, unit func(string) string, up func(string) bool) float64 {
+	lost := make(map[string]float64)
+	for osd, bytes := range used {
+		lost[unit(osd)] += bytes
+	}
+	free := make(map[string]float64)
+	totalFree := 0.0
+	for _, osd := range osds {
+		if !up(osd.name) {
+			continue
+		}
+		u := unit(osd.name)
+		free[u] += osd.free
+		totalFree += osd.free
+	}
+
+	worst := 0.0
+	for u, bytes := range lost {
+		if bytes <= 0 {
+			continue
+		}
+		remaining := len(free)
+		if _, found := free[u]; found {
+			remaining--
+		}
+		shortfall := bytes
+		if remaining >= pgSize {
+			shortfall = bytes - (totalFree - free[u])
+		}
+		if shortfall > worst {
+			worst = shortfall
+		}
+	}
+	return worst
+}
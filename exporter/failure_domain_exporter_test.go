@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"testing"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+// testHosts maps OSDs to their hosts.
+var testHosts = map[string]string{"1": "h1", "2": "h1", "3": "h2", "4": "h3", "5": "h4"}
+
+func testUnit(osd string) string {
+	return testHosts[osd]
+}
+
+func testUp(down ...string) func(string) bool {
+	return func(osd string) bool {
+		for _, d := range down {
+			if d == osd {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestToleratedFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		osdSets [][]uint64
+		minSize int
+		up      func(string) bool
+		want    int
+	}{
+		{
+			name:    "one chunk per host",
+			osdSets: [][]uint64{{1, 3, 4}, {3, 4, 5}},
+			minSize: 2,
+			up:      testUp(),
+			want:    1,
+		},
+		{
+			name:    "minsize 1",
+			osdSets: [][]uint64{{1, 3, 4}, {3, 4, 5}},
+			minSize: 1,
+			up:      testUp(),
+			want:    2,
+		},
+		{
+			name:    "down osd in pg set",
+			osdSets: [][]uint64{{1, 3, 4}, {3, 4, 5}},
+			minSize: 2,
+			up:      testUp("4"),
+			want:    0,
+		},
+		{
+			name:    "missing osd in pg set",
+			osdSets: [][]uint64{{1, 3, 0}},
+			minSize: 2,
+			up:      testUp(),
+			want:    0,
+		},
+		{
+			// Losing h1 takes two chunks at once
+			name:    "two chunks on one host",
+			osdSets: [][]uint64{{1, 2, 3}},
+			minSize: 2,
+			up:      testUp(),
+			want:    0,
+		},
+		{
+			name:    "pg already below minsize",
+			osdSets: [][]uint64{{1, 3, 4}},
+			minSize: 2,
+			up:      testUp("3", "4"),
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgs := make(map[string]config.VitastorPGConfigItem)
+			for i, osdSet := range tt.osdSets {
+				pgs[string(rune('1'+i))] = config.VitastorPGConfigItem{OSDSet: osdSet}
+			}
+			got := toleratedFailures(pgs, tt.minSize, testUnit, tt.up)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebuildShortfall(t *testing.T) {
+	osds := []capacityOsd{
+		{name: "1", free: 100},
+		{name: "2", free: 100},
+		{name: "3", free: 300},
+		{name: "4", free: 200},
+		{name: "5", free: 50},
+	}
+	tests := []struct {
+		name   string
+		used   map[string]float64
+		pgSize int
+		up     func(string) bool
+		want   float64
+	}{
+		{
+			name:   "room for rebuild",
+			used:   map[string]float64{"1": 100, "2": 100, "3": 200},
+			pgSize: 2,
+			up:     testUp(),
+			want:   0,
+		},
+		{
+			// Losing h2 leaves 450 free on other hosts for 600 bytes
+			name:   "not enough free space",
+			used:   map[string]float64{"3": 600},
+			pgSize: 2,
+			up:     testUp(),
+			want:   150,
+		},
+		{
+			// Without OSD 4 only 250 bytes are free besides h2
+			name:   "down osd has no free space",
+			used:   map[string]float64{"3": 600},
+			pgSize: 2,
+			up:     testUp("4"),
+			want:   350,
+		},
+		{
+			// After losing any host only three are left for four chunks
+			name:   "fewer domains than pg_size",
+			used:   map[string]float64{"1": 50, "3": 70},
+			pgSize: 4,
+			up:     testUp(),
+			want:   70,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rebuildShortfall(osds, tt.used, tt.pgSize, testUnit, tt.up)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
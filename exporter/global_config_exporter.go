@@ -0,0 +1,112 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// globalConfigCollector exports the settings of /config/global. Numbers and
+// booleans become gauges, everything else goes to an info metric. The hash
+// and mod_revision of the key change with every edit of the config.
+type globalConfigCollector struct {
+	value       *prometheus.Desc
+	info        *prometheus.Desc
+	hash        *prometheus.Desc
+	modRevision *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
+}
+
+func newGlobalConfigCollector(conf *config.VitastorConfig, logger *log.Entry) *globalConfigCollector {
+	return &globalConfigCollector{
+		value: prometheus.NewDesc(prometheus.BuildFQName(namespace, "global_config", "value"),
+			"Numeric global setting, booleans are 1 or 0",
+			[]string{"setting"},
+			nil),
+		info: prometheus.NewDesc(prometheus.BuildFQName(namespace, "global_config", "info"),
+			"Non-numeric global setting, lists and objects are JSON-encoded",
+			[]string{"setting", "value"},
+			nil),
+		hash: prometheus.NewDesc(prometheus.BuildFQName(namespace, "global_config", "hash"),
+			"FNV-1a hash of the global config document",
+			nil,
+			nil),
+		modRevision: prometheus.NewDesc(prometheus.BuildFQName(namespace, "global_config", "mod_revision"),
+			"etcd revision the global config was last changed at",
+			nil,
+			nil),
+		vitastorConfig: conf,
+		logger:         logger,
+	}
+}
+
+func (collector *globalConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.value
+	ch <- collector.info
+	ch <- collector.hash
+	ch <- collector.modRevision
+}
+
+func (collector *globalConfigCollector) name() string {
+	return "global_config"
+}
+
+func (collector *globalConfigCollector) paths() []string {
+	return []string{"/config/global"}
+}
+
+func (collector *globalConfigCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	globalConfigRaw := snap.get(collector.vitastorConfig.VitastorPrefix + "/config/global")
+	if globalConfigRaw == nil {
+		return nil
+	}
+	hash := fnv.New32a()
+	hash.Write(globalConfigRaw.Value)
+	ch <- prometheus.MustNewConstMetric(collector.hash, prometheus.GaugeValue, float64(hash.Sum32()))
+	ch <- prometheus.MustNewConstMetric(collector.modRevision, prometheus.GaugeValue, float64(globalConfigRaw.ModRevision))
+
+	var settings map[string]json.RawMessage
+	err := json.Unmarshal(globalConfigRaw.Value, &settings)
+	if err != nil {
+		collector.logger.Error(err, "Unable to parse global config")
+		return err
+	}
+	for setting, raw := range settings {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse global setting ", setting)
+			continue
+		}
+		switch v := value.(type) {
+		case json.Number:
+			number, err := v.Float64()
+			if err == nil {
+				ch <- prometheus.MustNewConstMetric(collector.value, prometheus.GaugeValue, number, setting)
+			}
+		case bool:
+			number := 0.0
+			if v {
+				number = 1
+			}
+			ch <- prometheus.MustNewConstMetric(collector.value, prometheus.GaugeValue, number, setting)
+		case string:
+			ch <- prometheus.MustNewConstMetric(collector.info, prometheus.GaugeValue, 1, setting, v)
+		case nil:
+		default:
+			ch <- prometheus.MustNewConstMetric(collector.info, prometheus.GaugeValue, 1, setting, string(raw))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// imageChainCollector follows parent_id of images to export how deep the
+// layer chain of every image is, how many clones every layer has and how
+// much space a chain takes. Snapshots are readonly layers, and a snapshot no
+// named image is cloned from any more only wastes space.
+type imageChainCollector struct {
+	depth         *prometheus.Desc
+	children      *prometheus.Desc
+	chainRawUsed  *prometheus.Desc
+	orphanedLayer *prometheus.Desc
+	orphaned      *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
+}
+
+func newImageChainCollector(conf *config.VitastorConfig, logger *log.Entry) *imageChainCollector {
+	return &imageChainCollector{
+		depth: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "chain_depth"),
+			"Number of layers reads of image go through, including the image itself",
+			[]string{"pool_id", "image_num", "image_name"},
+			nil),
+		children: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "children"),
+			"Number of images having image as parent",
+			[]string{"pool_id", "image_num", "image_name"},
+			nil),
+		chainRawUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "chain_raw_used"),
+			"Raw used space of image and all its parent layers in bytes",
+			[]string{"pool_id", "image_num", "image_name"},
+			nil),
+		orphanedLayer: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "orphaned_layer"),
+			"1 for readonly layers no image with a name has as parent",
+			[]string{"pool_id", "image_num", "image_name"},
+			nil),
+		orphaned: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "orphaned_layers"),
+			"Number of readonly layers in pool no image with a name has as parent",
+			[]string{"pool_id"},
+			nil),
+		vitastorConfig: conf,
+		logger:         logger,
+	}
+}
+
+func (collector *imageChainCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.depth
+	ch <- collector.children
+	ch <- collector.chainRawUsed
+	ch <- collector.orphanedLayer
+	ch <- collector.orphaned
+}
+
+func (collector *imageChainCollector) name() string {
+	return "image_chain"
+}
+
+func (collector *imageChainCollector) paths() []string {
+	return []string{"/config/inode/", "/inode/stats/"}
+}
+
+func (collector *imageChainCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	var parseErr error
+	prefix := collector.vitastorConfig.VitastorPrefix
+
+	imageConfigPath := prefix + "/config/inode/"
+	images := make(map[poolImage]config.VitastorImageConfig)
+	for _, v := range snap.list(imageConfigPath) {
+		var conf config.VitastorImageConfig
+		err := json.Unmarshal(v.Value, &conf)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse image config")
+			parseErr = err
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(string(v.Key), imageConfigPath), "/", 2)
+		if len(parts) == 2 {
+			images[poolImage{parts[0], parts[1]}] = conf
+		}
+	}
+
+	imageStatsPath := prefix + "/inode/stats/"
+	rawUsed := make(map[poolImage]float64)
+	for _, v := range snap.list(imageStatsPath) {
+		var st config.VitastorImageStats
+		err := json.Unmarshal(v.Value, &st)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse image stats")
+			parseErr = err
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(string(v.Key), imageStatsPath), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		used, err := st.RawUsed.Float64()
+		if err == nil {
+			rawUsed[poolImage{parts[0], parts[1]}] = used
+		}
+	}
+
+	parents := make(map[poolImage]poolImage)
+	children := make(map[poolImage]int)
+	namedChildren := make(map[poolImage]int)
+	for image, conf := range images {
+		if conf.ParentId == 0 {
+			continue
+		}
+		parent := poolImage{image.pool, strconv.FormatUint(conf.ParentId, 10)}
+		if conf.ParentPool != 0 {
+			parent.pool = strconv.FormatUint(conf.ParentPool, 10)
+		}
+		parents[image] = parent
+		children[parent]++
+		if conf.Name != "" {
+			namedChildren[parent]++
+		}
+	}
+
+	orphaned := make(map[string]int)
+	for image, conf := range images {
+		// Layers whose parent has no config end the chain, and a loop of
+		// parents is only walked once
+		depth := 0
+		used := 0.0
+		seen := make(map[poolImage]bool)
+		for layer, found := image, true; found && !seen[layer]; layer, found = parents[layer] {
+			if _, configured := images[layer]; !configured {
+				break
+			}
+			seen[layer] = true
+			depth++
+			used += rawUsed[layer]
+		}
+		ch <- prometheus.MustNewConstMetric(collector.depth, prometheus.GaugeValue, float64(depth), image.pool, image.image, conf.Name)
+		ch <- prometheus.MustNewConstMetric(collector.children, prometheus.GaugeValue, float64(children[image]), image.pool, image.image, conf.Name)
+		ch <- prometheus.MustNewConstMetric(collector.chainRawUsed, prometheus.GaugeValue, used, image.pool, image.image, conf.Name)
+
+		if _, found := orphaned[image.pool]; !found {
+			orphaned[image.pool] = 0
+		}
+		if conf.Readonly && namedChildren[image] == 0 {
+			orphaned[image.pool]++
+			ch <- prometheus.MustNewConstMetric(collector.orphanedLayer, prometheus.GaugeValue, 1, image.pool, image.image, conf.Name)
+		}
+	}
+	for pool_id, count := range orphaned {
+		ch <- prometheus.MustNewConstMetric(collector.orphaned, prometheus.GaugeValue, float64(count), pool_id)
+	}
+	return parseErr
+}
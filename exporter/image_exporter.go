@@ -6,183 +6,211 @@ import (
 	config "github.com/Antilles7227/vitastor-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"strconv"
 	"strings"
-	"time"
 )
 
 type imageCollector struct {
+	info        *prometheus.Desc
+	size        *prometheus.Desc
 	rawUsed     *prometheus.Desc
 	writeStats  *prometheus.Desc
 	readStats   *prometheus.Desc
 	deleteStats *prometheus.Desc
 
 	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
 }
 
-func newImageCollector(conf *config.VitastorConfig) *imageCollector {
+func newImageCollector(conf *config.VitastorConfig, logger *log.Entry) *imageCollector {
 	return &imageCollector{
+		info: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "info"),
+			"Image info",
+			[]string{"pool_id", "image_num", "image_name", "parent_pool", "parent_id", "readonly"},
+			nil),
+		size: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "size_bytes"),
+			"Image size in bytes",
+			[]string{"pool_id", "image_num", "image_name"},
+			nil),
 		rawUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "raw_used"),
 			"Image raw used in bytes",
-			[]string{"pool_id", "image_num"},
+			[]string{"pool_id", "image_num", "image_name"},
 			nil),
 		writeStats: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "write"),
 			"Image write stat",
-			[]string{"pool_id", "image_num", "stat_name"},
+			[]string{"pool_id", "image_num", "image_name", "stat_name"},
 			nil),
 		readStats: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "read"),
 			"Image read stat",
-			[]string{"pool_id", "image_num", "stat_name"},
+			[]string{"pool_id", "image_num", "image_name", "stat_name"},
 			nil),
 		deleteStats: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "delete"),
 			"Image delete stat",
-			[]string{"pool_id", "image_num", "stat_name"},
+			[]string{"pool_id", "image_num", "image_name", "stat_name"},
 			nil),
 		vitastorConfig: conf,
+		logger:         logger,
 	}
 }
 
 func (collector *imageCollector) Describe(ch chan<- *prometheus.Desc) {
 
 	//Update this section with the each metric you create for a given collector
+	ch <- collector.info
+	ch <- collector.size
 	ch <- collector.rawUsed
 	ch <- collector.writeStats
 	ch <- collector.readStats
 	ch <- collector.deleteStats
 }
 
-func (collector *imageCollector) Collect(ch chan<- prometheus.Metric) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   collector.vitastorConfig.VitastorEtcdUrls,
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		log.Error(err, "Unable to connect to etcd")
-		return
-	}
-	defer cli.Close()
+func (collector *imageCollector) name() string {
+	return "image"
+}
+
+func (collector *imageCollector) paths() []string {
+	return []string{"/config/pools", "/config/inode/", "/inode/stats/"}
+}
+
+func (collector *imageCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
 
 	//Collect pool ids
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
 	poolsPath := collector.vitastorConfig.VitastorPrefix + "/config/pools"
-	poolsConfigRaw, err := cli.Get(ctx, poolsPath)
-	cancel()
-	if err != nil {
-		log.Error(err, "Unable to retrive pools config")
-		return
-	}
+	poolsConfigRaw := snap.get(poolsPath)
 	var pools map[string]config.VitastorPoolConfig
-	if poolsConfigRaw.Count != 0 {
-		err = json.Unmarshal(poolsConfigRaw.Kvs[0].Value, &pools)
+	if poolsConfigRaw != nil {
+		err := json.Unmarshal(poolsConfigRaw.Value, &pools)
 		if err != nil {
-			log.Error(err, "Unable to parse pools config block")
-			return
+			collector.logger.Error(err, "Unable to parse pools config block")
+			return err
 		}
 	} else {
-		return
+		return nil
 	}
 
+	var parseErr error
 	for pool_id := range pools {
-		ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second*20)
-		imageStatsPath := collector.vitastorConfig.VitastorPrefix + "/inode/stats/" + pool_id
-		imageStatsRaw, err := cli.Get(ctx2, imageStatsPath, clientv3.WithPrefix())
-		cancel2()
-		if err != nil {
-			log.Error(err, "Unable to get image stats info")
-			return
-		}
-		imageStats := make(map[string]config.VitastorImageStats)
-		if imageStatsRaw.Count != 0 {
-			for _, v := range imageStatsRaw.Kvs {
-				var st config.VitastorImageStats
-				err = json.Unmarshal(v.Value, &st)
-				if err != nil {
-					log.Error(err, "Unable to parse image stats")
+		imageConfigPath := collector.vitastorConfig.VitastorPrefix + "/config/inode/" + pool_id + "/"
+		imageConfig := make(map[string]config.VitastorImageConfig)
+		for _, v := range snap.list(imageConfigPath) {
+			var conf config.VitastorImageConfig
+			err := json.Unmarshal(v.Value, &conf)
+			if err != nil {
+				collector.logger.Error(err, "Unable to parse image config")
+				parseErr = err
+				continue
+			}
+			image_num := strings.TrimPrefix(string(v.Key), imageConfigPath)
+			imageConfig[image_num] = conf
+
+			parent_pool, parent_id := "", ""
+			if conf.ParentId != 0 {
+				parent_pool = pool_id
+				if conf.ParentPool != 0 {
+					parent_pool = strconv.FormatUint(conf.ParentPool, 10)
 				}
-				image_num := strings.Split(string(v.Key), "/")[5]
-				imageStats[image_num] = st
+				parent_id = strconv.FormatUint(conf.ParentId, 10)
 			}
+			ch <- prometheus.MustNewConstMetric(collector.info, prometheus.GaugeValue, 1, pool_id, image_num, conf.Name, parent_pool, parent_id, strconv.FormatBool(conf.Readonly))
+			ch <- prometheus.MustNewConstMetric(collector.size, prometheus.GaugeValue, float64(conf.Size), pool_id, image_num, conf.Name)
+		}
+
+		imageStatsPath := collector.vitastorConfig.VitastorPrefix + "/inode/stats/" + pool_id + "/"
+		imageStatsRaw := snap.list(imageStatsPath)
+		imageStats := make(map[string]config.VitastorImageStats)
+		for _, v := range imageStatsRaw {
+			var st config.VitastorImageStats
+			err := json.Unmarshal(v.Value, &st)
+			if err != nil {
+				collector.logger.Error(err, "Unable to parse image stats")
+				parseErr = err
+			}
+			image_num := strings.TrimPrefix(string(v.Key), imageStatsPath)
+			imageStats[image_num] = st
 		}
 
 		for image, v := range imageStats {
+			// Stats of deleted images have no name
+			imageName := imageConfig[image].Name
 			raw_used, err := v.RawUsed.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.rawUsed, prometheus.CounterValue, raw_used, pool_id, image)
+				ch <- prometheus.MustNewConstMetric(collector.rawUsed, prometheus.CounterValue, raw_used, pool_id, image, imageName)
 			}
 			read_count, err := v.ReadStats.Count.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_count, pool_id, image, "count")
+				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_count, pool_id, image, imageName, "count")
 			}
 			read_usec, err := v.ReadStats.Usec.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_usec, pool_id, image, "usecs")
+				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_usec, pool_id, image, imageName, "usecs")
 			}
 			read_bytes, err := v.ReadStats.Bytes.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_bytes, pool_id, image, "bytes")
+				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_bytes, pool_id, image, imageName, "bytes")
 			}
 			read_bps, err := v.ReadStats.Bps.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_bps, pool_id, image, "bps")
+				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_bps, pool_id, image, imageName, "bps")
 			}
 			read_iops, err := v.ReadStats.Iops.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_iops, pool_id, image, "iops")
+				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_iops, pool_id, image, imageName, "iops")
 			}
 			read_lat, err := v.ReadStats.Lat.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_lat, pool_id, image, "lat")
+				ch <- prometheus.MustNewConstMetric(collector.readStats, prometheus.CounterValue, read_lat, pool_id, image, imageName, "lat")
 			}
 
 			write_count, err := v.WriteStats.Count.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_count, pool_id, image, "count")
+				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_count, pool_id, image, imageName, "count")
 			}
 			write_usec, err := v.WriteStats.Usec.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_usec, pool_id, image, "usecs")
+				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_usec, pool_id, image, imageName, "usecs")
 			}
 			write_bytes, err := v.WriteStats.Bytes.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_bytes, pool_id, image, "bytes")
+				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_bytes, pool_id, image, imageName, "bytes")
 			}
 			write_bps, err := v.WriteStats.Bps.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_bps, pool_id, image, "bps")
+				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_bps, pool_id, image, imageName, "bps")
 			}
 			write_iops, err := v.WriteStats.Iops.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_iops, pool_id, image, "iops")
+				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_iops, pool_id, image, imageName, "iops")
 			}
 			write_lat, err := v.WriteStats.Lat.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_lat, pool_id, image, "lat")
+				ch <- prometheus.MustNewConstMetric(collector.writeStats, prometheus.CounterValue, write_lat, pool_id, image, imageName, "lat")
 			}
 
 			delete_count, err := v.DeleteStats.Count.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_count, pool_id, image, "count")
+				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_count, pool_id, image, imageName, "count")
 			}
 			delete_usec, err := v.DeleteStats.Usec.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_usec, pool_id, image, "usecs")
+				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_usec, pool_id, image, imageName, "usecs")
 			}
 			delete_bytes, err := v.DeleteStats.Bytes.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_bytes, pool_id, image, "bytes")
+				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_bytes, pool_id, image, imageName, "bytes")
 			}
 			delete_bps, err := v.DeleteStats.Bps.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_bps, pool_id, image, "bps")
+				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_bps, pool_id, image, imageName, "bps")
 			}
 			delete_iops, err := v.DeleteStats.Iops.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_iops, pool_id, image, "iops")
+				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_iops, pool_id, image, imageName, "iops")
 			}
 			delete_lat, err := v.DeleteStats.Lat.Float64()
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_lat, pool_id, image, "lat")
+				ch <- prometheus.MustNewConstMetric(collector.deleteStats, prometheus.CounterValue, delete_lat, pool_id, image, imageName, "lat")
 			}
 		}
 	}
+	return parseErr
 }
@@ -0,0 +1,187 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Inode numbers share 64 bits with the pool id, which takes the upper 16.
+const maxInodeId = 1<<48 - 1
+
+// Checks run by indexCollector.
+const (
+	checkIndexWithoutConfig = "index_without_config"
+	checkConfigWithoutIndex = "config_without_index"
+	checkStatsWithoutConfig = "stats_without_config"
+)
+
+var indexChecks = []string{checkIndexWithoutConfig, checkConfigWithoutIndex, checkStatsWithoutConfig}
+
+// indexCollector cross-checks the image name index against image configs
+// and stats. Tools find images by name through the index, so an image
+// missing from it is invisible to them.
+type indexCollector struct {
+	inconsistencies   *prometheus.Desc
+	inconsistentImage *prometheus.Desc
+	maxId             *prometheus.Desc
+	idHeadroom        *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
+}
+
+func newIndexCollector(conf *config.VitastorConfig, logger *log.Entry) *indexCollector {
+	return &indexCollector{
+		inconsistencies: prometheus.NewDesc(prometheus.BuildFQName(namespace, "index", "inconsistencies"),
+			"Number of images of pool failing the index check",
+			[]string{"pool_id", "check"},
+			nil),
+		inconsistentImage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "index", "inconsistent_image"),
+			"Image failing the index check",
+			[]string{"pool_id", "image_num", "image_name", "check"},
+			nil),
+		maxId: prometheus.NewDesc(prometheus.BuildFQName(namespace, "index", "max_inode_id"),
+			"Largest inode number allocated in pool",
+			[]string{"pool_id"},
+			nil),
+		idHeadroom: prometheus.NewDesc(prometheus.BuildFQName(namespace, "index", "inode_id_headroom"),
+			"Number of inode numbers left in pool",
+			[]string{"pool_id"},
+			nil),
+		vitastorConfig: conf,
+		logger:         logger,
+	}
+}
+
+func (collector *indexCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.inconsistencies
+	ch <- collector.inconsistentImage
+	ch <- collector.maxId
+	ch <- collector.idHeadroom
+}
+
+func (collector *indexCollector) name() string {
+	return "index"
+}
+
+func (collector *indexCollector) paths() []string {
+	return []string{"/config/pools", "/config/inode/", "/index/image/", "/index/maxid/", "/inode/stats/"}
+}
+
+func (collector *indexCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	prefix := collector.vitastorConfig.VitastorPrefix
+	var parseErr error
+
+	counts := make(map[string]map[string]int)
+	poolCounts := func(pool_id string) map[string]int {
+		if counts[pool_id] == nil {
+			counts[pool_id] = make(map[string]int, len(indexChecks))
+			for _, check := range indexChecks {
+				counts[pool_id][check] = 0
+			}
+		}
+		return counts[pool_id]
+	}
+	report := func(image poolImage, image_name string, check string) {
+		poolCounts(image.pool)[check]++
+		ch <- prometheus.MustNewConstMetric(collector.inconsistentImage, prometheus.GaugeValue, 1, image.pool, image.image, image_name, check)
+	}
+
+	poolsConfigRaw := snap.get(prefix + "/config/pools")
+	if poolsConfigRaw != nil {
+		var pools map[string]config.VitastorPoolConfig
+		err := json.Unmarshal(poolsConfigRaw.Value, &pools)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse pools config block")
+			return err
+		}
+		for pool_id := range pools {
+			poolCounts(pool_id)
+		}
+	}
+
+	imageConfigPath := prefix + "/config/inode/"
+	imageConfig := make(map[poolImage]config.VitastorImageConfig)
+	for _, v := range snap.list(imageConfigPath) {
+		var conf config.VitastorImageConfig
+		err := json.Unmarshal(v.Value, &conf)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse image config")
+			parseErr = err
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(string(v.Key), imageConfigPath), "/", 2)
+		if len(parts) == 2 {
+			imageConfig[poolImage{parts[0], parts[1]}] = conf
+		}
+	}
+
+	indexPath := prefix + "/index/image/"
+	indexed := make(map[poolImage]bool)
+	for _, v := range snap.list(indexPath) {
+		var index config.VitastorImageIndex
+		err := json.Unmarshal(v.Value, &index)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse image index")
+			parseErr = err
+			continue
+		}
+		image_name := strings.TrimPrefix(string(v.Key), indexPath)
+		image := poolImage{strconv.FormatUint(index.PoolId, 10), strconv.FormatUint(index.Id, 10)}
+		conf, found := imageConfig[image]
+		if !found {
+			report(image, image_name, checkIndexWithoutConfig)
+		} else if conf.Name == image_name {
+			indexed[image] = true
+		}
+	}
+	for image, conf := range imageConfig {
+		if !indexed[image] {
+			report(image, conf.Name, checkConfigWithoutIndex)
+		}
+	}
+
+	imageStatsPath := prefix + "/inode/stats/"
+	for _, v := range snap.list(imageStatsPath) {
+		parts := strings.SplitN(strings.TrimPrefix(string(v.Key), imageStatsPath), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		image := poolImage{parts[0], parts[1]}
+		if _, found := imageConfig[image]; !found {
+			report(image, "", checkStatsWithoutConfig)
+		}
+	}
+
+	maxIdPath := prefix + "/index/maxid/"
+	for _, v := range snap.list(maxIdPath) {
+		maxId, err := strconv.ParseUint(strings.TrimSpace(string(v.Value)), 10, 64)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse max inode id")
+			parseErr = err
+			continue
+		}
+		pool_id := strings.TrimPrefix(string(v.Key), maxIdPath)
+		headroom := 0.0
+		if maxId < maxInodeId {
+			headroom = float64(maxInodeId - maxId)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.maxId, prometheus.GaugeValue, float64(maxId), pool_id)
+		ch <- prometheus.MustNewConstMetric(collector.idHeadroom, prometheus.GaugeValue, headroom, pool_id)
+	}
+
+	for pool_id, checks := range counts {
+		for check, count := range checks {
+			ch <- prometheus.MustNewConstMetric(collector.inconsistencies, prometheus.GaugeValue, float64(count), pool_id, check)
+		}
+	}
+	return parseErr
+}
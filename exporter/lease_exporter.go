@@ -0,0 +1,203 @@
+package exporter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Lease states reported by leaseCollector.
+const (
+	leaseOk       = "ok"
+	leaseMissing  = "no_lease"
+	leaseOrphaned = "orphaned"
+)
+
+var leaseStates = []string{leaseOk, leaseMissing, leaseOrphaned}
+
+// leaseParallelism limits concurrent lease lookups of one scrape.
+const leaseParallelism = 16
+
+// leaseCollector looks up the etcd leases OSDs and monitors keep their state
+// keys alive with. A hung daemon stops renewing its lease, so its TTL runs
+// down before the key disappears.
+type leaseCollector struct {
+	osdTtl     *prometheus.Desc
+	osdState   *prometheus.Desc
+	monTtl     *prometheus.Desc
+	monState   *prometheus.Desc
+	grantedTtl *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	etcd           *etcdClient
+	logger         *log.Entry
+}
+
+func newLeaseCollector(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, etcd *etcdClient, logger *log.Entry) *leaseCollector {
+	return &leaseCollector{
+		osdTtl: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "lease_ttl_seconds"),
+			"Remaining TTL of the etcd lease of OSD state key in seconds",
+			[]string{"osd_num", "lease_id"},
+			nil),
+		osdState: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "lease_state"),
+			"State of the etcd lease of OSD state key: ok, no_lease or orphaned",
+			[]string{"osd_num", "state"},
+			nil),
+		monTtl: prometheus.NewDesc(prometheus.BuildFQName(namespace, "monitor", "lease_ttl_seconds"),
+			"Remaining TTL of the etcd lease of monitor member key in seconds",
+			[]string{"monitor_id", "lease_id"},
+			nil),
+		monState: prometheus.NewDesc(prometheus.BuildFQName(namespace, "monitor", "lease_state"),
+			"State of the etcd lease of monitor member key: ok, no_lease or orphaned",
+			[]string{"monitor_id", "state"},
+			nil),
+		grantedTtl: prometheus.NewDesc(prometheus.BuildFQName(namespace, "etcd", "lease_granted_ttl_seconds"),
+			"TTL the etcd lease was granted with in seconds",
+			[]string{"lease_id"},
+			nil),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		etcd:           etcd,
+		logger:         logger,
+	}
+}
+
+func (collector *leaseCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.osdTtl
+	ch <- collector.osdState
+	ch <- collector.monTtl
+	ch <- collector.monState
+	ch <- collector.grantedTtl
+}
+
+func (collector *leaseCollector) name() string {
+	return "lease"
+}
+
+func (collector *leaseCollector) paths() []string {
+	return []string{"/osd/state/", "/mon/member/"}
+}
+
+// leaseTtl is the result of a lease lookup. ttl is -1 if the lease does not
+// exist anymore.
+type leaseTtl struct {
+	ttl     int64
+	granted int64
+}
+
+func (collector *leaseCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	osdStatePath := collector.vitastorConfig.VitastorPrefix + "/osd/state/"
+	monPath := collector.vitastorConfig.VitastorPrefix + "/mon/member/"
+	osdKeys := snap.list(osdStatePath)
+	monKeys := snap.list(monPath)
+	if len(osdKeys) == 0 && len(monKeys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, collector.exporterConfig.TimeoutFor("lease"))
+	defer cancel()
+	cli, err := collector.etcd.client(ctx)
+	if err != nil {
+		collector.logger.Error(err, "Unable to connect to etcd")
+		return err
+	}
+	leases, err := collector.lookup(ctx, cli, append(append([]*mvccpb.KeyValue(nil), osdKeys...), monKeys...))
+	if err != nil {
+		collector.logger.Error(err, "Unable to look up etcd leases")
+		// Running out of the lease budget is not the endpoint's fault
+		if ctx.Err() == nil && (isConnectionError(err) || isAuthError(err)) {
+			collector.etcd.failover(cli)
+		}
+	} else if len(leases) > 0 {
+		collector.etcd.succeeded(cli)
+	}
+
+	emit := func(kvs []*mvccpb.KeyValue, path string, ttlDesc *prometheus.Desc, stateDesc *prometheus.Desc) {
+		for _, kv := range kvs {
+			id := strings.TrimPrefix(string(kv.Key), path)
+			state := leaseOk
+			if kv.Lease == 0 {
+				state = leaseMissing
+			} else if lease, found := leases[kv.Lease]; !found {
+				// Lookup failed, the state is unknown
+				continue
+			} else {
+				if lease.ttl < 0 {
+					state = leaseOrphaned
+				}
+				ch <- prometheus.MustNewConstMetric(ttlDesc, prometheus.GaugeValue, float64(lease.ttl), id, strconv.FormatInt(kv.Lease, 16))
+			}
+			for _, s := range leaseStates {
+				value := 0.0
+				if s == state {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, value, id, s)
+			}
+		}
+	}
+	emit(osdKeys, osdStatePath, collector.osdTtl, collector.osdState)
+	emit(monKeys, monPath, collector.monTtl, collector.monState)
+	for id, lease := range leases {
+		if lease.ttl >= 0 {
+			ch <- prometheus.MustNewConstMetric(collector.grantedTtl, prometheus.GaugeValue, float64(lease.granted), strconv.FormatInt(id, 16))
+		}
+	}
+	if err != nil {
+		return &stageError{stage: stageFetch, err: err}
+	}
+	return nil
+}
+
+// lookup gets the TTLs of the leases of the given keys. On errors it returns
+// the leases looked up so far together with the last error.
+func (collector *leaseCollector) lookup(ctx context.Context, cli *clientv3.Client, kvs []*mvccpb.KeyValue) (map[int64]leaseTtl, error) {
+	ids := make(map[int64]bool)
+	for _, kv := range kvs {
+		if kv.Lease != 0 {
+			ids[kv.Lease] = true
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var lastErr error
+	leases := make(map[int64]leaseTtl, len(ids))
+	sem := make(chan struct{}, leaseParallelism)
+	for id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reqCtx, cancel := context.WithTimeout(ctx, collector.exporterConfig.EtcdRequestTimeout)
+			resp, err := cli.TimeToLive(reqCtx, clientv3.LeaseID(id))
+			cancel()
+			mu.Lock()
+			defer mu.Unlock()
+			if rpctypes.Error(err) == rpctypes.ErrLeaseNotFound {
+				leases[id] = leaseTtl{ttl: -1}
+				return
+			}
+			if err != nil {
+				lastErr = err
+				return
+			}
+			// etcd reports a TTL of -1 for leases it does not know
+			leases[id] = leaseTtl{ttl: resp.TTL, granted: resp.GrantedTTL}
+		}(id)
+	}
+	wg.Wait()
+	return leases, lastErr
+}
@@ -3,27 +3,27 @@ package exporter
 import (
 	"context"
 	"encoding/json"
-	"strings"
-	"time"
 	config "github.com/Antilles7227/vitastor-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
 )
 
 type monitorCollector struct {
-	info			*prometheus.Desc
+	info *prometheus.Desc
 
-	vitastorConfig	*config.VitastorConfig
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
 }
 
-func newMonitorCollector(conf *config.VitastorConfig) *monitorCollector {
+func newMonitorCollector(conf *config.VitastorConfig, logger *log.Entry) *monitorCollector {
 	return &monitorCollector{
-		info:		prometheus.NewDesc(prometheus.BuildFQName(namespace, "monitor", "info"),
-								"Monitor info, 1 is master, 0 is standby",
-								[]string{"monitor_id", "monitor_hostname", "monitor_ip"}, 
-								nil),
+		info: prometheus.NewDesc(prometheus.BuildFQName(namespace, "monitor", "info"),
+			"Monitor info, 1 is master, 0 is standby",
+			[]string{"monitor_id", "monitor_hostname", "monitor_ip"},
+			nil),
 		vitastorConfig: conf,
+		logger:         logger,
 	}
 }
 
@@ -32,53 +32,42 @@ func (collector *monitorCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.info
 }
 
-func (collector *monitorCollector) Collect(ch chan<- prometheus.Metric) {
+func (collector *monitorCollector) name() string {
+	return "monitor"
+}
 
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   collector.vitastorConfig.VitastorEtcdUrls,
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		log.Error(err, "Unable to connect to etcd")
-		return
-	}
-	defer cli.Close()
+func (collector *monitorCollector) paths() []string {
+	return []string{"/mon/master", "/mon/member/"}
+}
+
+func (collector *monitorCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 20)
 	masterMonPath := collector.vitastorConfig.VitastorPrefix + "/mon/master"
-	masterMonRaw, err := cli.Get(ctx, masterMonPath)
-	cancel()
-	if err != nil {
-		log.Error(err, "Unable to retrive master monitor block")
-		return
-	}
+	masterMonRaw := snap.get(masterMonPath)
 	var masterMonitor config.VitastorMonitor
-	if masterMonRaw.Count != 0 {
-		err = json.Unmarshal(masterMonRaw.Kvs[0].Value, &masterMonitor)
+	if masterMonRaw != nil {
+		err := json.Unmarshal(masterMonRaw.Value, &masterMonitor)
 		if err != nil {
-			log.Error(err, "Unable to parse master monitor block")
-			return
+			collector.logger.Error(err, "Unable to parse master monitor block")
+			return err
 		}
 	} else {
-		return
+		return nil
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second * 20)
-	monPath := collector.vitastorConfig.VitastorPrefix + "/mon/member"
-	monRaw, err := cli.Get(ctx, monPath, clientv3.WithPrefix())
-	cancel()
-	if err != nil {
-		log.Error(err, "Unable to retrive monitors list")
-		return
-	}
-	monitors := make([]config.VitastorMonitor, monRaw.Count)
-	if monRaw.Count != 0 {
-		for i, v := range monRaw.Kvs {
-			err = json.Unmarshal(v.Value, &monitors[i])
+	monPath := collector.vitastorConfig.VitastorPrefix + "/mon/member/"
+	monRaw := snap.list(monPath)
+	monitors := make([]config.VitastorMonitor, len(monRaw))
+	var parseErr error
+	if len(monRaw) != 0 {
+		for i, v := range monRaw {
+			err := json.Unmarshal(v.Value, &monitors[i])
 			if err != nil {
-				log.Error(err, "Unable to parse pool stats")
+				collector.logger.Error(err, "Unable to parse pool stats")
+				parseErr = err
+				continue
 			}
-			id := strings.Split(string(v.Key), "/")[4]
+			id := strings.TrimPrefix(string(v.Key), monPath)
 			if id == masterMonitor.Id {
 				ch <- prometheus.MustNewConstMetric(collector.info, prometheus.CounterValue, 1, string(v.Key), monitors[i].Hostname, monitors[i].Ip[0])
 			} else {
@@ -86,4 +75,5 @@ func (collector *monitorCollector) Collect(ch chan<- prometheus.Metric) {
 			}
 		}
 	}
-}
\ No newline at end of file
+	return parseErr
+}
@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// osdConfigCollector exports admin settings of OSDs. It covers every OSD that
+// is configured or has ever reported stats, so OSDs which were set up but
+// never started are visible too.
+type osdConfigCollector struct {
+	reweight      *prometheus.Desc
+	noout         *prometheus.Desc
+	tags          *prometheus.Desc
+	statsReported *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
+}
+
+func newOsdConfigCollector(conf *config.VitastorConfig, logger *log.Entry) *osdConfigCollector {
+	return &osdConfigCollector{
+		reweight: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "reweight"),
+			"OSD reweight, 1 if not set",
+			[]string{"osd_num"},
+			nil),
+		noout: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "noout"),
+			"1 if OSD is not marked out when it goes down, 0 otherwise",
+			[]string{"osd_num"},
+			nil),
+		tags: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "tags_info"),
+			"OSD tags, comma-separated",
+			[]string{"osd_num", "tags"},
+			nil),
+		statsReported: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "stats_reported"),
+			"1 if OSD has ever reported stats, 0 if it is only configured",
+			[]string{"osd_num"},
+			nil),
+		vitastorConfig: conf,
+		logger:         logger,
+	}
+}
+
+func (collector *osdConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.reweight
+	ch <- collector.noout
+	ch <- collector.tags
+	ch <- collector.statsReported
+}
+
+func (collector *osdConfigCollector) name() string {
+	return "osd_config"
+}
+
+func (collector *osdConfigCollector) paths() []string {
+	return []string{"/config/osd/", "/osd/stats/"}
+}
+
+func (collector *osdConfigCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	osdConfigPath := collector.vitastorConfig.VitastorPrefix + "/config/osd/"
+	osdStatsPath := collector.vitastorConfig.VitastorPrefix + "/osd/stats/"
+
+	var parseErr error
+	osdConfig := make(map[string]config.VitastorOSDConfig)
+	for _, v := range snap.list(osdConfigPath) {
+		var conf config.VitastorOSDConfig
+		err := json.Unmarshal(v.Value, &conf)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse osd config")
+			parseErr = err
+		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdConfigPath)
+		osdConfig[osd_num] = conf
+	}
+	reported := make(map[string]bool)
+	for _, v := range snap.list(osdStatsPath) {
+		osd_num := strings.TrimPrefix(string(v.Key), osdStatsPath)
+		reported[osd_num] = true
+		if _, found := osdConfig[osd_num]; !found {
+			osdConfig[osd_num] = config.VitastorOSDConfig{}
+		}
+	}
+
+	for osd, conf := range osdConfig {
+		noout := 0.0
+		if conf.NoOut {
+			noout = 1
+		}
+		statsReported := 0.0
+		if reported[osd] {
+			statsReported = 1
+		}
+		tags := append([]string(nil), conf.Tags...)
+		sort.Strings(tags)
+		ch <- prometheus.MustNewConstMetric(collector.reweight, prometheus.GaugeValue, conf.GetReweight(), osd)
+		ch <- prometheus.MustNewConstMetric(collector.noout, prometheus.GaugeValue, noout, osd)
+		ch <- prometheus.MustNewConstMetric(collector.tags, prometheus.GaugeValue, 1, osd, strings.Join(tags, ","))
+		ch <- prometheus.MustNewConstMetric(collector.statsReported, prometheus.GaugeValue, statsReported, osd)
+	}
+	return parseErr
+}
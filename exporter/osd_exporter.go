@@ -6,10 +6,8 @@ import (
 	config "github.com/Antilles7227/vitastor-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
-	clientv3 "go.etcd.io/etcd/client/v3"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type osdCollector struct {
@@ -23,9 +21,10 @@ type osdCollector struct {
 	statsCount        *prometheus.Desc
 
 	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
 }
 
-func newOsdCollector(conf *config.VitastorConfig) *osdCollector {
+func newOsdCollector(conf *config.VitastorConfig, logger *log.Entry) *osdCollector {
 	return &osdCollector{
 		params: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "status"),
 			"OSD info. 1 if OSD up, 0 if down",
@@ -60,6 +59,7 @@ func newOsdCollector(conf *config.VitastorConfig) *osdCollector {
 			[]string{"osd_num", "stat_type", "stat_name"},
 			nil),
 		vitastorConfig: conf,
+		logger:         logger,
 	}
 }
 
@@ -76,55 +76,42 @@ func (collector *osdCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.statsUsec
 }
 
-func (collector *osdCollector) Collect(ch chan<- prometheus.Metric) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   collector.vitastorConfig.VitastorEtcdUrls,
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		log.Error(err, "Unable to connect to etcd")
-		return
-	}
-	defer cli.Close()
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
-	osdStatePath := collector.vitastorConfig.VitastorPrefix + "/osd/state"
-	osdStateRaw, err := cli.Get(ctx, osdStatePath, clientv3.WithPrefix())
-	cancel()
-	if err != nil {
-		log.Error(err, "Unable to get osd state info")
-	}
-	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second*20)
-	osdStatsPath := collector.vitastorConfig.VitastorPrefix + "/osd/stats"
-	osdStatsRaw, err := cli.Get(ctx2, osdStatsPath, clientv3.WithPrefix())
-	cancel2()
-	if err != nil {
-		log.Error(err, "Unable to get osd stats info")
-		return
-	}
+func (collector *osdCollector) name() string {
+	return "osd"
+}
+
+func (collector *osdCollector) paths() []string {
+	return []string{"/osd/state/", "/osd/stats/"}
+}
+
+func (collector *osdCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	osdStatePath := collector.vitastorConfig.VitastorPrefix + "/osd/state/"
+	osdStateRaw := snap.list(osdStatePath)
+	osdStatsPath := collector.vitastorConfig.VitastorPrefix + "/osd/stats/"
+	osdStatsRaw := snap.list(osdStatsPath)
 
 	osdState := make(map[string]config.VitastorOSDState)
 	osdStats := make(map[string]config.VitastorOSDStats)
-	if osdStateRaw.Count != 0 {
-		for _, v := range osdStateRaw.Kvs {
-			var st config.VitastorOSDState
-			err = json.Unmarshal(v.Value, &st)
-			if err != nil {
-				log.Error(err, "Unable to parse osd state")
-			}
-			osd_num := strings.Split(string(v.Key), "/")[4]
-			osdState[osd_num] = st
+	var parseErr error
+	for _, v := range osdStateRaw {
+		var st config.VitastorOSDState
+		err := json.Unmarshal(v.Value, &st)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse osd state")
+			parseErr = err
 		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdStatePath)
+		osdState[osd_num] = st
 	}
-	if osdStatsRaw.Count != 0 {
-		for _, v := range osdStatsRaw.Kvs {
-			var st config.VitastorOSDStats
-			err = json.Unmarshal(v.Value, &st)
-			if err != nil {
-				log.Error(err, "Unable to parse osd stats")
-			}
-			osd_num := strings.Split(string(v.Key), "/")[4]
-			osdStats[osd_num] = st
+	for _, v := range osdStatsRaw {
+		var st config.VitastorOSDStats
+		err := json.Unmarshal(v.Value, &st)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse osd stats")
+			parseErr = err
 		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdStatsPath)
+		osdStats[osd_num] = st
 	}
 
 	for osd, v := range osdStats {
@@ -154,4 +141,5 @@ func (collector *osdCollector) Collect(ch chan<- prometheus.Metric) {
 			ch <- prometheus.MustNewConstMetric(collector.statsUsec, prometheus.CounterValue, float64(stats.Usec), osd, "subop", rec)
 		}
 	}
+	return parseErr
 }
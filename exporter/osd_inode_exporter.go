@@ -0,0 +1,184 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// osdInodeCollector exports IO counters of every image on every OSD. The
+// number of OSD and image pairs grows with the cluster, so only the pairs
+// with the most traffic since the previous scrape are exported, up to the
+// configured limit. Ranking by recent rather than lifetime traffic keeps an
+// image that was busy long ago from hiding one that is busy now.
+type osdInodeCollector struct {
+	statsBytes *prometheus.Desc
+	statsCount *prometheus.Desc
+	statsUsec  *prometheus.Desc
+	dropped    *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+
+	mu       sync.Mutex
+	traffic  map[osdInodeKey]int
+	selected map[osdInodeKey]bool
+}
+
+type osdInodeKey struct {
+	osd   string
+	pool  string
+	inode string
+}
+
+func newOsdInodeCollector(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, logger *log.Entry) *osdInodeCollector {
+	return &osdInodeCollector{
+		statsBytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "inode_stat_bytes"),
+			"Bytes of image handled by OSD",
+			[]string{"osd_num", "pool_id", "image_num", "op"},
+			nil),
+		statsCount: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "inode_stat_count"),
+			"Operations on image handled by OSD",
+			[]string{"osd_num", "pool_id", "image_num", "op"},
+			nil),
+		statsUsec: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "inode_stat_usec"),
+			"Time OSD spent on operations on image in usecs",
+			[]string{"osd_num", "pool_id", "image_num", "op"},
+			nil),
+		dropped: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "inode_stats_dropped"),
+			"Number of OSD and image pairs not exported because of --osd-inode-stats-limit",
+			nil,
+			nil),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		logger:         logger,
+		traffic:        make(map[osdInodeKey]int),
+		selected:       make(map[osdInodeKey]bool),
+	}
+}
+
+func (collector *osdInodeCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.statsBytes
+	ch <- collector.statsCount
+	ch <- collector.statsUsec
+	ch <- collector.dropped
+}
+
+func (collector *osdInodeCollector) name() string {
+	return "osd_inodestats"
+}
+
+func (collector *osdInodeCollector) paths() []string {
+	if collector.exporterConfig.OSDInodeStatsLimit <= 0 {
+		return nil
+	}
+	return []string{"/osd/inodestats/"}
+}
+
+type osdInodeStats struct {
+	osd   string
+	pool  string
+	inode string
+	stats config.VitastorOSDInodeStats
+}
+
+func (s *osdInodeStats) key() osdInodeKey {
+	return osdInodeKey{osd: s.osd, pool: s.pool, inode: s.inode}
+}
+
+func (s *osdInodeStats) traffic() int {
+	return s.stats.Read.Bytes + s.stats.Write.Bytes + s.stats.Delete.Bytes
+}
+
+// busiest returns the pairs with the most bytes since the previous scrape,
+// up to limit, and the number of pairs left out. Pairs seen for the first
+// time and pairs whose counters were reset by an OSD restart count all their
+// bytes. Ties go to the pairs exported last time, so that idle pairs do not
+// take turns.
+func (collector *osdInodeCollector) busiest(all []osdInodeStats, limit int) ([]osdInodeStats, int) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	traffic := make(map[osdInodeKey]int, len(all))
+	recent := make([]int, len(all))
+	for i := range all {
+		key := all[i].key()
+		traffic[key] = all[i].traffic()
+		recent[i] = traffic[key]
+		if prev, found := collector.traffic[key]; found && prev <= recent[i] {
+			recent[i] -= prev
+		}
+	}
+	collector.traffic = traffic
+
+	dropped := 0
+	if len(all) > limit {
+		order := make([]int, len(all))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			a, b := order[i], order[j]
+			if recent[a] != recent[b] {
+				return recent[a] > recent[b]
+			}
+			return collector.selected[all[a].key()] && !collector.selected[all[b].key()]
+		})
+		busiest := make([]osdInodeStats, limit)
+		for i := range busiest {
+			busiest[i] = all[order[i]]
+		}
+		dropped = len(all) - limit
+		all = busiest
+	}
+	collector.selected = make(map[osdInodeKey]bool, len(all))
+	for i := range all {
+		collector.selected[all[i].key()] = true
+	}
+	return all, dropped
+}
+
+func (collector *osdInodeCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	limit := collector.exporterConfig.OSDInodeStatsLimit
+	if limit <= 0 {
+		return nil
+	}
+
+	var parseErr error
+	var all []osdInodeStats
+	osdInodeStatsPath := collector.vitastorConfig.VitastorPrefix + "/osd/inodestats/"
+	for _, v := range snap.list(osdInodeStatsPath) {
+		var st map[string]map[string]config.VitastorOSDInodeStats
+		err := json.Unmarshal(v.Value, &st)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse osd inode stats")
+			parseErr = err
+			continue
+		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdInodeStatsPath)
+		for pool_id, inodes := range st {
+			for image_num, stats := range inodes {
+				all = append(all, osdInodeStats{osd: osd_num, pool: pool_id, inode: image_num, stats: stats})
+			}
+		}
+	}
+
+	all, dropped := collector.busiest(all, limit)
+	for _, s := range all {
+		for op, stats := range map[string]config.OSDStats{"read": s.stats.Read, "write": s.stats.Write, "delete": s.stats.Delete} {
+			ch <- prometheus.MustNewConstMetric(collector.statsBytes, prometheus.CounterValue, float64(stats.Bytes), s.osd, s.pool, s.inode, op)
+			ch <- prometheus.MustNewConstMetric(collector.statsCount, prometheus.CounterValue, float64(stats.Count), s.osd, s.pool, s.inode, op)
+			ch <- prometheus.MustNewConstMetric(collector.statsUsec, prometheus.CounterValue, float64(stats.Usec), s.osd, s.pool, s.inode, op)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.dropped, prometheus.GaugeValue, float64(dropped))
+	return parseErr
+}
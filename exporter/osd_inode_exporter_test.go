@@ -0,0 +1,75 @@
+package exporter
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+// testInodeStats builds the stats of OSD 1 with the given written bytes per
+// image.
+func testInodeStats(written map[string]int) []osdInodeStats {
+	var all []osdInodeStats
+	for inode, bytes := range written {
+		all = append(all, osdInodeStats{osd: "1", pool: "1", inode: inode, stats: config.VitastorOSDInodeStats{Write: config.OSDStats{Bytes: bytes}}})
+	}
+	return all
+}
+
+func TestBusiest(t *testing.T) {
+	steps := []struct {
+		name        string
+		written     map[string]int
+		want        []string
+		wantDropped int
+	}{
+		{
+			name:        "first scrape ranks by total",
+			written:     map[string]int{"1": 1000, "2": 500, "3": 100},
+			want:        []string{"1", "2"},
+			wantDropped: 1,
+		},
+		{
+			// Image 1 is idle now, image 3 is busy
+			name:        "recent traffic",
+			written:     map[string]int{"1": 1000, "2": 600, "3": 400},
+			want:        []string{"2", "3"},
+			wantDropped: 1,
+		},
+		{
+			name:        "idle pairs stay selected",
+			written:     map[string]int{"1": 1000, "2": 600, "3": 400},
+			want:        []string{"2", "3"},
+			wantDropped: 1,
+		},
+		{
+			// Image 1 restarted counting from zero on an OSD restart
+			name:        "counter reset",
+			written:     map[string]int{"1": 50, "2": 610, "3": 400},
+			want:        []string{"1", "2"},
+			wantDropped: 1,
+		},
+		{
+			name:    "new pair",
+			written: map[string]int{"1": 50, "4": 10},
+			want:    []string{"1", "4"},
+		},
+	}
+	collector := &osdInodeCollector{
+		traffic:  make(map[osdInodeKey]int),
+		selected: make(map[osdInodeKey]bool),
+	}
+	for _, step := range steps {
+		busiest, dropped := collector.busiest(testInodeStats(step.written), 2)
+		var got []string
+		for _, s := range busiest {
+			got = append(got, s.inode)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, step.want) || dropped != step.wantDropped {
+			t.Errorf("%s: got %v, %d dropped, want %v, %d dropped", step.name, got, dropped, step.want, step.wantDropped)
+		}
+	}
+}
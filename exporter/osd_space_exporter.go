@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// osdSpaceCollector exports the space images occupy on OSDs, summed per
+// image and per pool on every OSD. Usage of every image on every OSD is only
+// exported if enabled, as the number of such series grows with the cluster.
+type osdSpaceCollector struct {
+	imageUsed    *prometheus.Desc
+	osdPoolUsed  *prometheus.Desc
+	osdImageUsed *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+}
+
+func newOsdSpaceCollector(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, logger *log.Entry) *osdSpaceCollector {
+	return &osdSpaceCollector{
+		imageUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "image", "osd_used_bytes"),
+			"Space image occupies on all OSDs in bytes",
+			[]string{"pool_id", "image_num"},
+			nil),
+		osdPoolUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "pool_used_bytes"),
+			"Space pool occupies on OSD in bytes",
+			[]string{"osd_num", "pool_id"},
+			nil),
+		osdImageUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "image_used_bytes"),
+			"Space image occupies on OSD in bytes",
+			[]string{"osd_num", "pool_id", "image_num"},
+			nil),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		logger:         logger,
+	}
+}
+
+func (collector *osdSpaceCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.imageUsed
+	ch <- collector.osdPoolUsed
+	ch <- collector.osdImageUsed
+}
+
+func (collector *osdSpaceCollector) name() string {
+	return "osd_space"
+}
+
+func (collector *osdSpaceCollector) paths() []string {
+	return []string{"/osd/space/"}
+}
+
+type poolImage struct {
+	pool  string
+	image string
+}
+
+func (collector *osdSpaceCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	var parseErr error
+	imageUsed := make(map[poolImage]uint64)
+	osdSpacePath := collector.vitastorConfig.VitastorPrefix + "/osd/space/"
+	for _, v := range snap.list(osdSpacePath) {
+		var space map[string]map[string]uint64
+		err := json.Unmarshal(v.Value, &space)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse osd space")
+			parseErr = err
+			continue
+		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdSpacePath)
+		for pool_id, images := range space {
+			var poolUsed uint64
+			for image_num, used := range images {
+				poolUsed += used
+				imageUsed[poolImage{pool_id, image_num}] += used
+				if collector.exporterConfig.OSDSpacePerImage {
+					ch <- prometheus.MustNewConstMetric(collector.osdImageUsed, prometheus.GaugeValue, float64(used), osd_num, pool_id, image_num)
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(collector.osdPoolUsed, prometheus.GaugeValue, float64(poolUsed), osd_num, pool_id)
+		}
+	}
+	for image, used := range imageUsed {
+		ch <- prometheus.MustNewConstMetric(collector.imageUsed, prometheus.GaugeValue, float64(used), image.pool, image.image)
+	}
+	return parseErr
+}
@@ -0,0 +1,289 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// pgStates are the PG state flags set by the Vitastor monitor. Counts of all
+// of them are exported for every pool, so absent states show up as 0.
+var pgStates = []string{
+	"starting",
+	"peering",
+	"incomplete",
+	"active",
+	"repeering",
+	"stopping",
+	"offline",
+	"degraded",
+	"has_corrupted",
+	"has_incomplete",
+	"has_degraded",
+	"has_misplaced",
+	"has_unclean",
+	"has_invalid",
+	"has_inconsistent",
+	"left_on_dead",
+	"scrubbing",
+}
+
+type pgCollector struct {
+	count           *prometheus.Desc
+	primaryOsd      *prometheus.Desc
+	active          *prometheus.Desc
+	poolObjectCount *prometheus.Desc
+	objectCount     *prometheus.Desc
+	writeOsdSet     *prometheus.Desc
+	epoch           *prometheus.Desc
+	historySets     *prometheus.Desc
+	waitingOnDown   *prometheus.Desc
+	downPeers       *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+}
+
+func newPgCollector(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, logger *log.Entry) *pgCollector {
+	return &pgCollector{
+		count: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "count"),
+			"Number of PGs of pool with the state flag set",
+			[]string{"pool_name", "pool_id", "state"},
+			nil),
+		primaryOsd: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "primary_osd"),
+			"Primary OSD of PG",
+			[]string{"pool_name", "pool_id", "pg_num"},
+			nil),
+		active: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "active"),
+			"1 if PG is active, 0 otherwise",
+			[]string{"pool_name", "pool_id", "pg_num"},
+			nil),
+		poolObjectCount: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "object_count"),
+			"Pool object count summed over its PGs",
+			[]string{"pool_name", "pool_id", "object_type"},
+			nil),
+		objectCount: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "object_count"),
+			"PG object count",
+			[]string{"pool_name", "pool_id", "pg_num", "object_type"},
+			nil),
+		writeOsdSet: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "write_osd_set"),
+			"OSDs PG writes go to, 0 marks a missing OSD",
+			[]string{"pool_name", "pool_id", "pg_num", "write_osd_set"},
+			nil),
+		epoch: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "epoch"),
+			"PG epoch, increased on every peering",
+			[]string{"pool_name", "pool_id", "pg_num"},
+			nil),
+		historySets: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "history_osd_sets"),
+			"Number of previous OSD sets of PG",
+			[]string{"pool_name", "pool_id", "pg_num"},
+			nil),
+		waitingOnDown: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "waiting_on_down_osds"),
+			"Number of PGs of pool whose previous OSD sets include down OSDs",
+			[]string{"pool_name", "pool_id"},
+			nil),
+		downPeers: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pg", "with_down_peers"),
+			"Number of PGs of pool whose all_peers include down OSDs",
+			[]string{"pool_name", "pool_id"},
+			nil),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		logger:         logger,
+	}
+}
+
+func (collector *pgCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.count
+	ch <- collector.primaryOsd
+	ch <- collector.active
+	ch <- collector.poolObjectCount
+	ch <- collector.objectCount
+	ch <- collector.writeOsdSet
+	ch <- collector.epoch
+	ch <- collector.historySets
+	ch <- collector.waitingOnDown
+	ch <- collector.downPeers
+}
+
+func (collector *pgCollector) name() string {
+	return "pg"
+}
+
+func (collector *pgCollector) paths() []string {
+	return []string{"/config/pools", "/pg/state/", "/pg/stats/", "/pg/history/", "/osd/state/"}
+}
+
+func (collector *pgCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	poolsPath := collector.vitastorConfig.VitastorPrefix + "/config/pools"
+	poolsConfigRaw := snap.get(poolsPath)
+	var pools map[string]config.VitastorPoolConfig
+	if poolsConfigRaw != nil {
+		err := json.Unmarshal(poolsConfigRaw.Value, &pools)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse pools config block")
+			return err
+		}
+	} else {
+		return nil
+	}
+
+	var parseErr error
+	for pool_id, pool := range pools {
+		counts := make(map[string]int, len(pgStates))
+		for _, state := range pgStates {
+			counts[state] = 0
+		}
+
+		pgStatePath := collector.vitastorConfig.VitastorPrefix + "/pg/state/" + pool_id + "/"
+		reported := make(map[string]bool)
+		for _, v := range snap.list(pgStatePath) {
+			pg_num := strings.TrimPrefix(string(v.Key), pgStatePath)
+			reported[pg_num] = true
+			var st config.VitastorPGState
+			err := json.Unmarshal(v.Value, &st)
+			if err != nil {
+				collector.logger.Error(err, "Unable to parse pg state")
+				parseErr = err
+				continue
+			}
+			active := 0.0
+			for _, state := range st.State {
+				counts[state]++
+				if state == "active" {
+					active = 1
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(collector.primaryOsd, prometheus.GaugeValue, float64(st.Primary), pool.Name, pool_id, pg_num)
+			ch <- prometheus.MustNewConstMetric(collector.active, prometheus.GaugeValue, active, pool.Name, pool_id, pg_num)
+		}
+
+		// The monitor removes the state of a PG that has no primary, such
+		// PGs are offline
+		for pg := 1; pg <= int(pool.PGCount); pg++ {
+			pg_num := strconv.Itoa(pg)
+			if !reported[pg_num] {
+				counts["offline"]++
+				ch <- prometheus.MustNewConstMetric(collector.active, prometheus.GaugeValue, 0, pool.Name, pool_id, pg_num)
+			}
+		}
+
+		for state, count := range counts {
+			ch <- prometheus.MustNewConstMetric(collector.count, prometheus.GaugeValue, float64(count), pool.Name, pool_id, state)
+		}
+
+		err := collector.collectStats(snap, pool_id, pool.Name, ch)
+		if err != nil {
+			parseErr = err
+		}
+		err = collector.collectHistory(snap, pool_id, pool.Name, ch)
+		if err != nil {
+			parseErr = err
+		}
+	}
+	return parseErr
+}
+
+// collectHistory exports peering history of the PGs of the pool. A PG can
+// not get rid of its previous OSD sets until it has peered with their OSDs,
+// so a down OSD in them keeps the PG waiting. all_peers are all OSDs that
+// may hold objects of the PG, a down one among them may hide some of its
+// data.
+func (collector *pgCollector) collectHistory(snap *snapshot, pool_id string, pool_name string, ch chan<- prometheus.Metric) error {
+	var parseErr error
+	waiting := 0
+	downPeers := 0
+	osdStatePath := collector.vitastorConfig.VitastorPrefix + "/osd/state/"
+	pgHistoryPath := collector.vitastorConfig.VitastorPrefix + "/pg/history/" + pool_id + "/"
+	for _, v := range snap.list(pgHistoryPath) {
+		var history config.VitastorPGHistory
+		err := json.Unmarshal(v.Value, &history)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse pg history")
+			parseErr = err
+			continue
+		}
+		pg_num := strings.TrimPrefix(string(v.Key), pgHistoryPath)
+		ch <- prometheus.MustNewConstMetric(collector.epoch, prometheus.GaugeValue, float64(history.Epoch), pool_name, pool_id, pg_num)
+		ch <- prometheus.MustNewConstMetric(collector.historySets, prometheus.GaugeValue, float64(len(history.OSDSets)), pool_name, pool_id, pg_num)
+
+		down := func(osd uint64) bool {
+			return osd != 0 && snap.get(osdStatePath+strconv.FormatUint(osd, 10)) == nil
+		}
+
+	sets:
+		for _, set := range history.OSDSets {
+			for _, osd := range set {
+				if down(osd) {
+					waiting++
+					break sets
+				}
+			}
+		}
+		for _, osd := range history.AllPeers {
+			if down(osd) {
+				downPeers++
+				break
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.waitingOnDown, prometheus.GaugeValue, float64(waiting), pool_name, pool_id)
+	ch <- prometheus.MustNewConstMetric(collector.downPeers, prometheus.GaugeValue, float64(downPeers), pool_name, pool_id)
+	return parseErr
+}
+
+// collectStats exports object counts of the pool and, if enabled, of its
+// PGs.
+func (collector *pgCollector) collectStats(snap *snapshot, pool_id string, pool_name string, ch chan<- prometheus.Metric) error {
+	var parseErr error
+	var total config.VitastorPGStats
+	pgStatsPath := collector.vitastorConfig.VitastorPrefix + "/pg/stats/" + pool_id + "/"
+	for _, v := range snap.list(pgStatsPath) {
+		var st config.VitastorPGStats
+		err := json.Unmarshal(v.Value, &st)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse pg stats")
+			parseErr = err
+			continue
+		}
+		total.ObjectCount += st.ObjectCount
+		total.CleanCount += st.CleanCount
+		total.MisplacedCount += st.MisplacedCount
+		total.DegradedCount += st.DegradedCount
+		total.IncompleteCount += st.IncompleteCount
+
+		if !collector.exporterConfig.PGStatsPerPG {
+			continue
+		}
+		pg_num := strings.TrimPrefix(string(v.Key), pgStatsPath)
+		for object_type, count := range pgObjectCounts(&st) {
+			ch <- prometheus.MustNewConstMetric(collector.objectCount, prometheus.GaugeValue, float64(count), pool_name, pool_id, pg_num, object_type)
+		}
+		osds := make([]string, len(st.WriteOSDSet))
+		for i, osd := range st.WriteOSDSet {
+			osds[i] = strconv.FormatUint(osd, 10)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.writeOsdSet, prometheus.GaugeValue, 1, pool_name, pool_id, pg_num, strings.Join(osds, ","))
+	}
+	for object_type, count := range pgObjectCounts(&total) {
+		ch <- prometheus.MustNewConstMetric(collector.poolObjectCount, prometheus.GaugeValue, float64(count), pool_name, pool_id, object_type)
+	}
+	return parseErr
+}
+
+func pgObjectCounts(st *config.VitastorPGStats) map[string]uint64 {
+	return map[string]uint64{
+		"object":     st.ObjectCount,
+		"clean":      st.CleanCount,
+		"misplaced":  st.MisplacedCount,
+		"degraded":   st.DegradedCount,
+		"incomplete": st.IncompleteCount,
+	}
+}
@@ -0,0 +1,140 @@
+package exporter
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+// placementTree is the failure domain tree of the cluster, built the same
+// way the monitor builds it: every OSD that reported stats hangs under its
+// host, and /config/node_placement may move OSDs and hosts anywhere below
+// racks, datacenters or any other level.
+type placementTree struct {
+	nodes map[string]*placementNode
+	// osds are the names of OSD nodes, sorted
+	osds []string
+}
+
+type placementNode struct {
+	name   string
+	level  string
+	parent string
+}
+
+// buildPlacementTree reads the tree from node_placement and OSD stats. It
+// returns the tree even when node_placement can not be parsed, together with
+// the parse error.
+func buildPlacementTree(snap *snapshot, prefix string) (*placementTree, map[string]config.VitastorOSDStats, error) {
+	tree := &placementTree{
+		nodes: make(map[string]*placementNode),
+	}
+	var parseErr error
+
+	osdStatsPath := prefix + "/osd/stats/"
+	osdStats := make(map[string]config.VitastorOSDStats)
+	for _, v := range snap.list(osdStatsPath) {
+		var st config.VitastorOSDStats
+		err := json.Unmarshal(v.Value, &st)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+		osd_num := strings.TrimPrefix(string(v.Key), osdStatsPath)
+		osdStats[osd_num] = st
+		tree.nodes[osd_num] = &placementNode{name: osd_num, level: "osd", parent: st.Host}
+		if st.Host != "" && tree.nodes[st.Host] == nil {
+			tree.nodes[st.Host] = &placementNode{name: st.Host, level: "host"}
+		}
+	}
+
+	placementRaw := snap.get(prefix + "/config/node_placement")
+	if placementRaw != nil {
+		var placement map[string]config.VitastorNodePlacement
+		err := json.Unmarshal(placementRaw.Value, &placement)
+		if err != nil {
+			parseErr = err
+		}
+		for name, p := range placement {
+			node := tree.nodes[name]
+			if node == nil {
+				node = &placementNode{name: name, level: "host"}
+				if isOsdNum(name) {
+					node.level = "osd"
+				}
+				tree.nodes[name] = node
+			}
+			if p.Level != "" {
+				node.level = p.Level
+			}
+			if p.Parent != "" {
+				node.parent = p.Parent
+			}
+		}
+	}
+
+	// Parents referenced without being defined are hosts, like OSD hosts
+	for _, node := range tree.nodes {
+		if node.parent != "" && tree.nodes[node.parent] == nil {
+			tree.nodes[node.parent] = &placementNode{name: node.parent, level: "host"}
+		}
+	}
+	for name, node := range tree.nodes {
+		if node.level == "osd" {
+			tree.osds = append(tree.osds, name)
+		}
+	}
+	sortOsdNums(tree.osds)
+	return tree, osdStats, parseErr
+}
+
+// path returns the ancestors of the node from the root down to its parent.
+func (t *placementTree) path(name string) []*placementNode {
+	var path []*placementNode
+	seen := map[string]bool{name: true}
+	node := t.nodes[name]
+	for node != nil && node.parent != "" && !seen[node.parent] {
+		seen[node.parent] = true
+		node = t.nodes[node.parent]
+		path = append([]*placementNode{node}, path...)
+	}
+	return path
+}
+
+// ancestor returns the name of the node's ancestor at the given level, or
+// the node itself if the level is osd or no ancestor has that level.
+func (t *placementTree) ancestor(name string, level string) string {
+	for _, node := range t.path(name) {
+		if node.level == level {
+			return node.name
+		}
+	}
+	return name
+}
+
+func isOsdNum(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortOsdNums sorts OSD numbers numerically.
+func sortOsdNums(osds []string) {
+	sort.Slice(osds, func(i, j int) bool {
+		a, _ := strconv.ParseUint(osds[i], 10, 64)
+		b, _ := strconv.ParseUint(osds[j], 10, 64)
+		if a != b {
+			return a < b
+		}
+		return osds[i] < osds[j]
+	})
+}
@@ -0,0 +1,120 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// placementCollector exports the failure domain of every OSD and rolls OSD
+// space and state up to every node of the placement tree.
+type placementCollector struct {
+	info     *prometheus.Desc
+	size     *prometheus.Desc
+	free     *prometheus.Desc
+	osdsUp   *prometheus.Desc
+	osdsDown *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
+}
+
+func newPlacementCollector(conf *config.VitastorConfig, logger *log.Entry) *placementCollector {
+	return &placementCollector{
+		info: prometheus.NewDesc(prometheus.BuildFQName(namespace, "osd", "placement_info"),
+			"OSD placement. path lists the ancestors of OSD from the root as level=name pairs",
+			[]string{"osd_num", "host", "path"},
+			nil),
+		size: prometheus.NewDesc(prometheus.BuildFQName(namespace, "placement", "size_bytes"),
+			"Total size of OSDs under placement node in bytes",
+			[]string{"level", "node"},
+			nil),
+		free: prometheus.NewDesc(prometheus.BuildFQName(namespace, "placement", "free_bytes"),
+			"Free size of OSDs under placement node in bytes",
+			[]string{"level", "node"},
+			nil),
+		osdsUp: prometheus.NewDesc(prometheus.BuildFQName(namespace, "placement", "osds_up"),
+			"Number of up OSDs under placement node",
+			[]string{"level", "node"},
+			nil),
+		osdsDown: prometheus.NewDesc(prometheus.BuildFQName(namespace, "placement", "osds_down"),
+			"Number of down OSDs under placement node",
+			[]string{"level", "node"},
+			nil),
+		vitastorConfig: conf,
+		logger:         logger,
+	}
+}
+
+func (collector *placementCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.info
+	ch <- collector.size
+	ch <- collector.free
+	ch <- collector.osdsUp
+	ch <- collector.osdsDown
+}
+
+func (collector *placementCollector) name() string {
+	return "placement"
+}
+
+func (collector *placementCollector) paths() []string {
+	return []string{"/config/node_placement", "/osd/stats/", "/osd/state/"}
+}
+
+type placementRollup struct {
+	level    string
+	size     float64
+	free     float64
+	osdsUp   float64
+	osdsDown float64
+}
+
+func (collector *placementCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	tree, osdStats, err := buildPlacementTree(snap, collector.vitastorConfig.VitastorPrefix)
+	if err != nil {
+		collector.logger.Error(err, "Unable to parse node placement")
+	}
+	osdStatePath := collector.vitastorConfig.VitastorPrefix + "/osd/state/"
+
+	rollups := make(map[string]*placementRollup)
+	for _, osd := range tree.osds {
+		stats := osdStats[osd]
+		up := snap.get(osdStatePath+osd) != nil
+
+		var path []string
+		host := ""
+		for _, node := range tree.path(osd) {
+			path = append(path, node.level+"="+node.name)
+			if node.level == "host" {
+				host = node.name
+			}
+			rollup := rollups[node.name]
+			if rollup == nil {
+				rollup = &placementRollup{level: node.level}
+				rollups[node.name] = rollup
+			}
+			rollup.size += float64(stats.Size)
+			rollup.free += float64(stats.Free)
+			if up {
+				rollup.osdsUp++
+			} else {
+				rollup.osdsDown++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(collector.info, prometheus.GaugeValue, 1, osd, host, strings.Join(path, "/"))
+	}
+
+	for node, rollup := range rollups {
+		ch <- prometheus.MustNewConstMetric(collector.size, prometheus.GaugeValue, rollup.size, rollup.level, node)
+		ch <- prometheus.MustNewConstMetric(collector.free, prometheus.GaugeValue, rollup.free, rollup.level, node)
+		ch <- prometheus.MustNewConstMetric(collector.osdsUp, prometheus.GaugeValue, rollup.osdsUp, rollup.level, node)
+		ch <- prometheus.MustNewConstMetric(collector.osdsDown, prometheus.GaugeValue, rollup.osdsDown, rollup.level, node)
+	}
+	return err
+}
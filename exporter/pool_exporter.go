@@ -3,49 +3,52 @@ package exporter
 import (
 	"context"
 	"encoding/json"
-	"time"
-	"strconv"
 	config "github.com/Antilles7227/vitastor-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
-	clientv3 "go.etcd.io/etcd/client/v3"
-
+	"strconv"
 )
 
-
 type poolCollector struct {
-	params			*prometheus.Desc
-	usedRawTb 		*prometheus.Desc
-	totalRawTb 		*prometheus.Desc
+	params          *prometheus.Desc
+	usedRawTb       *prometheus.Desc
+	totalRawTb      *prometheus.Desc
 	spaceEfficiency *prometheus.Desc
-	rawToUsable 	*prometheus.Desc
+	rawToUsable     *prometheus.Desc
+	availableBytes  *prometheus.Desc
 
-	vitastorConfig	*config.VitastorConfig
+	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
 }
 
-func newPoolCollector(conf *config.VitastorConfig) *poolCollector {
+func newPoolCollector(conf *config.VitastorConfig, logger *log.Entry) *poolCollector {
 	return &poolCollector{
-		params:		prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "info"),
-								"Pool info",
-								[]string{"pool_name", "pool_id", "pool_scheme", "pg_size", "parity_chunks", "pg_minsize", "pg_count", "failure_domain"}, 
-								nil),
-		usedRawTb: 	prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "used_raw_tb"),
-								"Raw used space of pool in TB",
-								[]string{"pool_name", "pool_id"}, 
-								nil),
+		params: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "info"),
+			"Pool info",
+			[]string{"pool_name", "pool_id", "pool_scheme", "pg_size", "parity_chunks", "pg_minsize", "pg_count", "failure_domain"},
+			nil),
+		usedRawTb: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "used_raw_tb"),
+			"Raw used space of pool in TB",
+			[]string{"pool_name", "pool_id"},
+			nil),
 		totalRawTb: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "total_raw_tb"),
-								"Total raw space of pool in TB",
-								[]string{"pool_name", "pool_id"},
-								nil),
+			"Total raw space of pool in TB",
+			[]string{"pool_name", "pool_id"},
+			nil),
 		spaceEfficiency: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "space_efficiency"),
-								"Pool space usage efficiency",
-								[]string{"pool_name", "pool_id"},
-								nil),
+			"Pool space usage efficiency",
+			[]string{"pool_name", "pool_id"},
+			nil),
 		rawToUsable: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "raw_to_usable"),
-								"Raw to usable space ratio",
-								[]string{"pool_name", "pool_id"},
-								nil),
+			"Raw to usable space ratio",
+			[]string{"pool_name", "pool_id"},
+			nil),
+		availableBytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "available_bytes"),
+			"Usable space left in pool in bytes, as reported by vitastor-cli df",
+			[]string{"pool_name", "pool_id"},
+			nil),
 		vitastorConfig: conf,
+		logger:         logger,
 	}
 }
 
@@ -57,70 +60,61 @@ func (collector *poolCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.totalRawTb
 	ch <- collector.rawToUsable
 	ch <- collector.spaceEfficiency
+	ch <- collector.availableBytes
 }
 
-//Collect implements required collect function for all promehteus collectors
-func (collector *poolCollector) Collect(ch chan<- prometheus.Metric) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   collector.vitastorConfig.VitastorEtcdUrls,
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		log.Error(err, "Unable to connect to etcd")
-		return
-	}
-	defer cli.Close()
+func (collector *poolCollector) name() string {
+	return "pool"
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 20)
+func (collector *poolCollector) paths() []string {
+	return []string{"/config/pools", "/pool/stats/", "/config/pgs", "/config/osd/", "/config/node_placement", "/osd/stats/"}
+}
+
+func (collector *poolCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
 	poolsPath := collector.vitastorConfig.VitastorPrefix + "/config/pools"
-	poolsConfigRaw, err := cli.Get(ctx, poolsPath)
-	cancel()
-	if err != nil {
-		log.Error(err, "Unable to retrive pools config")
-		return
-	}
+	poolsConfigRaw := snap.get(poolsPath)
 	var pools map[string]config.VitastorPoolConfig
-	if poolsConfigRaw.Count != 0 {
-		err = json.Unmarshal(poolsConfigRaw.Kvs[0].Value, &pools)
+	if poolsConfigRaw != nil {
+		err := json.Unmarshal(poolsConfigRaw.Value, &pools)
 		if err != nil {
-			log.Error(err, "Unable to parse pools config block")
-			return
+			collector.logger.Error(err, "Unable to parse pools config block")
+			return err
 		}
 	} else {
-		return
+		return nil
 	}
 
-	
+	layout, parseErr := loadClusterLayout(snap, collector.vitastorConfig.VitastorPrefix)
+	if parseErr != nil {
+		collector.logger.Error(parseErr, "Unable to parse cluster layout")
+	}
 	for id, v := range pools {
 		poolStats := &config.VitastorPoolStats{}
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second * 20)
 		poolStatsPath := collector.vitastorConfig.VitastorPrefix + "/pool/stats/" + id
-		poolStatsRaw, err := cli.Get(ctx, poolStatsPath)
-		cancel()
-		if err != nil {
-			log.Error(err, "Unable to retrive pool stats")
-			return
-		}
-		if poolStatsRaw.Count != 0 {
-			err = json.Unmarshal(poolStatsRaw.Kvs[0].Value, poolStats)
+		poolStatsRaw := snap.get(poolStatsPath)
+		if poolStatsRaw != nil {
+			err := json.Unmarshal(poolStatsRaw.Value, poolStats)
 			if err != nil {
-				log.Error(err, "Unable to parse pool stats")
+				collector.logger.Error(err, "Unable to parse pool stats")
+				parseErr = err
 			}
 		}
 
-		ch <- prometheus.MustNewConstMetric(collector.params, prometheus.GaugeValue, 1, v.Name, 
-																						id,
-																						v.Scheme,
-																						strconv.Itoa(int(v.PGSize)),
-																						strconv.Itoa(int(v.ParityChunks)),
-																						strconv.Itoa(int(v.PGMinSize)),
-																						strconv.Itoa(int(v.PGCount)),
-																						v.FailureDomain)
+		ch <- prometheus.MustNewConstMetric(collector.params, prometheus.GaugeValue, 1, v.Name,
+			id,
+			v.Scheme,
+			strconv.Itoa(int(v.PGSize)),
+			strconv.Itoa(int(v.ParityChunks)),
+			strconv.Itoa(int(v.PGMinSize)),
+			strconv.Itoa(int(v.PGCount)),
+			v.FailureDomain)
 
 		ch <- prometheus.MustNewConstMetric(collector.totalRawTb, prometheus.GaugeValue, poolStats.TotalRawTb, v.Name, id)
 		ch <- prometheus.MustNewConstMetric(collector.usedRawTb, prometheus.GaugeValue, poolStats.UsedRawTb, v.Name, id)
 		ch <- prometheus.MustNewConstMetric(collector.spaceEfficiency, prometheus.GaugeValue, poolStats.SpaceEfficiency, v.Name, id)
 		ch <- prometheus.MustNewConstMetric(collector.rawToUsable, prometheus.GaugeValue, poolStats.RawToUsable, v.Name, id)
+		ch <- prometheus.MustNewConstMetric(collector.availableBytes, prometheus.GaugeValue, layout.poolAvailable(id, &v), v.Name, id)
 	}
+	return parseErr
 }
-
@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// fixedSource hands out a snapshot that was taken in advance.
+type fixedSource struct {
+	snap *snapshot
+}
+
+func (s *fixedSource) snapshot(ctx context.Context) (*snapshot, error) {
+	return s.snap, nil
+}
+
+// probeHandler serves /probe in the style of blackbox_exporter: every request
+// connects to the etcd given in the query, renders the metrics of that
+// cluster and disconnects. Credentials come from named profiles of the
+// exporter config, so they never appear in URLs.
+type probeHandler struct {
+	profiles       map[string]config.ClusterConfig
+	exporterConfig *config.ExporterConfig
+}
+
+func NewProbeHandler(profiles map[string]config.ClusterConfig, exporterConfig *config.ExporterConfig) http.Handler {
+	return &probeHandler{
+		profiles:       profiles,
+		exporterConfig: exporterConfig,
+	}
+}
+
+// probeConfig builds the connection settings of a probe request.
+func (h *probeHandler) probeConfig(r *http.Request) (*config.VitastorConfig, error) {
+	query := r.URL.Query()
+	var conf config.VitastorConfig
+	var allowed config.EtcdAddress
+	restricted := false
+	if name := query.Get("profile"); name != "" {
+		profile, found := h.profiles[name]
+		if !found {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		conf = profile.VitastorConfig
+		// Credentials of a profile must only be sent to the etcd it was
+		// written for, so such profiles only probe the addresses they list
+		allowed = append(append(allowed, profile.VitastorEtcdUrls...), profile.ProbeTargets...)
+		restricted = len(allowed) > 0 || conf.HasCredentials()
+	}
+	if target := query.Get("target"); target != "" {
+		targets := config.ParseEtcdAddress(target)
+		if restricted {
+			err := checkProbeTargets(targets, allowed, &conf)
+			if err != nil {
+				return nil, err
+			}
+		}
+		conf.VitastorEtcdUrls = targets
+	}
+	if prefix := query.Get("prefix"); prefix != "" {
+		conf.VitastorPrefix = prefix
+	}
+	if len(conf.VitastorEtcdUrls) == 0 {
+		return nil, fmt.Errorf("target parameter is missing")
+	}
+	err := conf.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// checkProbeTargets makes sure every target is one of the allowed addresses.
+// Addresses are compared in normalized form.
+func checkProbeTargets(targets config.EtcdAddress, allowed config.EtcdAddress, conf *config.VitastorConfig) error {
+	scheme := "http"
+	if conf.UseTLS() {
+		scheme = "https"
+	}
+	allowedUrls := make(map[string]bool, len(allowed))
+	for _, addr := range allowed {
+		u, err := config.NormalizeEtcdUrl(addr, scheme)
+		if err == nil {
+			allowedUrls[u] = true
+		}
+	}
+	for _, target := range targets {
+		u, err := config.NormalizeEtcdUrl(target, scheme)
+		if err != nil {
+			return err
+		}
+		if !allowedUrls[u] {
+			return fmt.Errorf("target %q is not allowed by the profile", target)
+		}
+	}
+	return nil
+}
+
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conf, err := h.probeConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger := log.WithField("target", conf.VitastorEtcdUrls).WithField("prefix", conf.VitastorPrefix)
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: prometheus.BuildFQName(namespace, "probe", "success"),
+		Help: "1 if the probe could read the Vitastor tree, 0 otherwise",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: prometheus.BuildFQName(namespace, "probe", "duration_seconds"),
+		Help: "How long the probe took to read the Vitastor tree in seconds",
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccess)
+	registry.MustRegister(probeDuration)
+
+	scrapeCtx, scrapeCancel := scrapeContext(r, h.exporterConfig.ScrapeTimeoutOffset)
+	defer scrapeCancel()
+	etcd := newEtcdClient(conf, h.exporterConfig, logger)
+	defer etcd.Close()
+	vitastorCollectors := newVitastorCollectors(conf, h.exporterConfig, etcd, logger)
+	reader := newEtcdReader(conf.VitastorPrefix, etcd, collectorPaths(vitastorCollectors))
+	registry.MustRegister(&boundCollector{ctx: scrapeCtx, collector: newEtcdCollector(conf, h.exporterConfig, etcd, logger)})
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(scrapeCtx, h.exporterConfig.TimeoutFor("snapshot"))
+	snap, err := reader.snapshot(ctx)
+	cancel()
+	probeDuration.Set(time.Since(start).Seconds())
+	if err != nil {
+		logger.Error(err, "Probe failed")
+	} else {
+		probeSuccess.Set(1)
+		registry.MustRegister(&boundCollector{ctx: scrapeCtx, collector: newClusterCollector(&fixedSource{snap: snap}, vitastorCollectors, h.exporterConfig, logger)})
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
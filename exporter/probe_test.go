@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+func TestProbeConfig(t *testing.T) {
+	h := &probeHandler{profiles: map[string]config.ClusterConfig{
+		"creds": {
+			ProbeTargets: config.EtcdAddress{"http://10.0.0.1:2379"},
+			VitastorConfig: config.VitastorConfig{
+				EtcdUsername: "monitor",
+				EtcdPassword: "secret",
+			},
+		},
+		"listed": {
+			VitastorConfig: config.VitastorConfig{
+				VitastorEtcdUrls: config.EtcdAddress{"10.0.0.2:2379", "10.0.0.3:2379"},
+			},
+		},
+		"open": {
+			VitastorConfig: config.VitastorConfig{VitastorPrefix: "/cluster1"},
+		},
+	}}
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantUrls   []string
+		wantPrefix string
+		wantErr    bool
+	}{
+		{
+			name:       "no profile",
+			query:      url.Values{"target": {"10.0.0.9:2379"}},
+			wantUrls:   []string{"http://10.0.0.9:2379"},
+			wantPrefix: "/vitastor",
+		},
+		{
+			name:    "unknown profile",
+			query:   url.Values{"target": {"10.0.0.1:2379"}, "profile": {"missing"}},
+			wantErr: true,
+		},
+		{
+			name:    "credentials to an unlisted target",
+			query:   url.Values{"target": {"10.0.0.9:2379"}, "profile": {"creds"}},
+			wantErr: true,
+		},
+		{
+			name:       "credentials to a listed target in another form",
+			query:      url.Values{"target": {"10.0.0.1:2379/v3"}, "profile": {"creds"}},
+			wantUrls:   []string{"http://10.0.0.1:2379"},
+			wantPrefix: "/vitastor",
+		},
+		{
+			name:    "one of several targets unlisted",
+			query:   url.Values{"target": {"10.0.0.1:2379,10.0.0.9:2379"}, "profile": {"creds"}},
+			wantErr: true,
+		},
+		{
+			name:       "etcd_address of the profile",
+			query:      url.Values{"target": {"http://10.0.0.3:2379"}, "profile": {"listed"}},
+			wantUrls:   []string{"http://10.0.0.3:2379"},
+			wantPrefix: "/vitastor",
+		},
+		{
+			name:       "profile address without target",
+			query:      url.Values{"profile": {"listed"}},
+			wantUrls:   []string{"http://10.0.0.2:2379", "http://10.0.0.3:2379"},
+			wantPrefix: "/vitastor",
+		},
+		{
+			name:       "profile without addresses and credentials",
+			query:      url.Values{"target": {"10.0.0.9:2379"}, "profile": {"open"}},
+			wantUrls:   []string{"http://10.0.0.9:2379"},
+			wantPrefix: "/cluster1",
+		},
+		{
+			name:       "prefix parameter",
+			query:      url.Values{"target": {"10.0.0.9:2379"}, "profile": {"open"}, "prefix": {"/cluster2"}},
+			wantUrls:   []string{"http://10.0.0.9:2379"},
+			wantPrefix: "/cluster2",
+		},
+		{
+			name:    "no target",
+			query:   url.Values{"profile": {"open"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := h.probeConfig(httptest.NewRequest("GET", "/probe?"+tt.query.Encode(), nil))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", conf.VitastorEtcdUrls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual([]string(conf.VitastorEtcdUrls), tt.wantUrls) {
+				t.Errorf("got %v, want %v", conf.VitastorEtcdUrls, tt.wantUrls)
+			}
+			if conf.VitastorPrefix != tt.wantPrefix {
+				t.Errorf("got prefix %q, want %q", conf.VitastorPrefix, tt.wantPrefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultBlockSize is the block size of pools that neither set it nor have it
+// set in the global config.
+const defaultBlockSize = 131072
+
+// recoveryCollector estimates how long recovery of every pool will take. It
+// remembers the bytes left to recover at every scrape and derives the
+// recovery rate from how fast they went down within the rate window. When
+// they go up, a new failure has added work and the estimate starts over.
+type recoveryCollector struct {
+	remaining *prometheus.Desc
+	rate      *prometheus.Desc
+	eta       *prometheus.Desc
+
+	vitastorConfig *config.VitastorConfig
+	exporterConfig *config.ExporterConfig
+	logger         *log.Entry
+
+	mu      sync.Mutex
+	samples map[string][]recoverySample
+}
+
+type recoverySample struct {
+	time      time.Time
+	remaining float64
+}
+
+func newRecoveryCollector(conf *config.VitastorConfig, exporterConfig *config.ExporterConfig, logger *log.Entry) *recoveryCollector {
+	return &recoveryCollector{
+		remaining: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "recovery_remaining_bytes"),
+			"Bytes of degraded or misplaced objects of pool left to recover",
+			[]string{"pool_name", "pool_id", "object_type"},
+			nil),
+		rate: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "recovery_bytes_per_second"),
+			"Rate at which bytes left to recover in pool went down over the rate window since the last new failure",
+			[]string{"pool_name", "pool_id"},
+			nil),
+		eta: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "recovery_eta_seconds"),
+			"Estimated seconds until all objects of pool are clean at the current recovery rate, +Inf if recovery makes no progress",
+			[]string{"pool_name", "pool_id"},
+			nil),
+		vitastorConfig: conf,
+		exporterConfig: exporterConfig,
+		logger:         logger,
+		samples:        make(map[string][]recoverySample),
+	}
+}
+
+func (collector *recoveryCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	//Update this section with the each metric you create for a given collector
+	ch <- collector.remaining
+	ch <- collector.rate
+	ch <- collector.eta
+}
+
+func (collector *recoveryCollector) name() string {
+	return "recovery"
+}
+
+func (collector *recoveryCollector) paths() []string {
+	return []string{"/config/pools", "/config/global", "/pg/stats/"}
+}
+
+func (collector *recoveryCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
+	now := time.Now()
+	prefix := collector.vitastorConfig.VitastorPrefix
+	poolsConfigRaw := snap.get(prefix + "/config/pools")
+	if poolsConfigRaw == nil {
+		return nil
+	}
+	var pools map[string]config.VitastorPoolConfig
+	err := json.Unmarshal(poolsConfigRaw.Value, &pools)
+	if err != nil {
+		collector.logger.Error(err, "Unable to parse pools config block")
+		return err
+	}
+
+	var parseErr error
+	blockSize := float64(defaultBlockSize)
+	globalConfigRaw := snap.get(prefix + "/config/global")
+	if globalConfigRaw != nil {
+		var global struct {
+			BlockSize float64 `json:"block_size"`
+		}
+		err := json.Unmarshal(globalConfigRaw.Value, &global)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse global config")
+			parseErr = err
+		} else if global.BlockSize > 0 {
+			blockSize = global.BlockSize
+		}
+	}
+
+	degraded := make(map[string]float64)
+	misplaced := make(map[string]float64)
+	pgStatsPath := prefix + "/pg/stats/"
+	for _, v := range snap.list(pgStatsPath) {
+		parts := strings.SplitN(strings.TrimPrefix(string(v.Key), pgStatsPath), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		var stats config.VitastorPGStats
+		err := json.Unmarshal(v.Value, &stats)
+		if err != nil {
+			collector.logger.Error(err, "Unable to parse PG stats")
+			parseErr = err
+			continue
+		}
+		degraded[parts[0]] += float64(stats.DegradedCount)
+		misplaced[parts[0]] += float64(stats.MisplacedCount)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for id := range collector.samples {
+		if _, found := pools[id]; !found {
+			delete(collector.samples, id)
+		}
+	}
+	for id, pool := range pools {
+		objectSize := blockSize
+		if pool.BlockSize > 0 {
+			objectSize = float64(pool.BlockSize)
+		}
+		objectSize *= float64(dataChunks(&pool))
+		degradedBytes := degraded[id] * objectSize
+		misplacedBytes := misplaced[id] * objectSize
+		ch <- prometheus.MustNewConstMetric(collector.remaining, prometheus.GaugeValue, degradedBytes, pool.Name, id, "degraded")
+		ch <- prometheus.MustNewConstMetric(collector.remaining, prometheus.GaugeValue, misplacedBytes, pool.Name, id, "misplaced")
+
+		rate, ok := collector.addSample(id, recoverySample{now, degradedBytes + misplacedBytes})
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.rate, prometheus.GaugeValue, rate, pool.Name, id)
+		eta := math.Inf(1)
+		if degradedBytes+misplacedBytes == 0 {
+			eta = 0
+		} else if rate > 0 {
+			eta = (degradedBytes + misplacedBytes) / rate
+		}
+		ch <- prometheus.MustNewConstMetric(collector.eta, prometheus.GaugeValue, eta, pool.Name, id)
+	}
+	return parseErr
+}
+
+// addSample records the bytes left to recover in the pool and returns the
+// rate they went down at. It returns false if there is not enough history
+// yet to tell the rate.
+func (collector *recoveryCollector) addSample(pool_id string, sample recoverySample) (float64, bool) {
+	samples := collector.samples[pool_id]
+	if len(samples) > 0 && sample.remaining > samples[len(samples)-1].remaining {
+		samples = nil
+	}
+	samples = append(samples, sample)
+	// Keep the newest sample older than the window, so that the rate is
+	// taken over the whole window
+	for len(samples) > 2 && sample.time.Sub(samples[1].time) >= collector.exporterConfig.RecoveryRateWindow {
+		samples = samples[1:]
+	}
+	collector.samples[pool_id] = samples
+
+	oldest := samples[0]
+	elapsed := sample.time.Sub(oldest.time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (oldest.remaining - sample.remaining) / elapsed, true
+}
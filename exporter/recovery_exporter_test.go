@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+)
+
+func TestAddSample(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		seconds   int
+		remaining float64
+		wantRate  float64
+		wantOk    bool
+	}{
+		{0, 1000, 0, false},
+		{10, 900, 10, true},
+		{20, 700, 15, true},
+		// A new failure adds work, the rate is unknown until the next scrape
+		{30, 1200, 0, false},
+		{40, 1100, 10, true},
+		// Samples older than the 60s window are dropped except the newest
+		// of them: the rate is taken from 40s on
+		{100, 800, 5, true},
+		{110, 700, 400.0 / 70, true},
+		{120, 700, 5, true},
+		// No progress over the whole window
+		{200, 700, 0, true},
+	}
+	collector := &recoveryCollector{
+		exporterConfig: &config.ExporterConfig{RecoveryRateWindow: time.Minute},
+		samples:        make(map[string][]recoverySample),
+	}
+	for _, step := range steps {
+		rate, ok := collector.addSample("1", recoverySample{start.Add(time.Duration(step.seconds) * time.Second), step.remaining})
+		if ok != step.wantOk || (ok && rate != step.wantRate) {
+			t.Errorf("at %ds: got %v, %v, want %v, %v", step.seconds, rate, ok, step.wantRate, step.wantOk)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	config "github.com/Antilles7227/vitastor-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// contextCollector is a collector whose work is bounded by the context of
+// the scrape it runs in.
+type contextCollector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	collectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// boundCollector runs a contextCollector within one scrape.
+type boundCollector struct {
+	ctx       context.Context
+	collector contextCollector
+}
+
+func (b *boundCollector) Describe(ch chan<- *prometheus.Desc) {
+	b.collector.Describe(ch)
+}
+
+func (b *boundCollector) Collect(ch chan<- prometheus.Metric) {
+	b.collector.collectContext(b.ctx, ch)
+}
+
+type scrapeCollector struct {
+	labels    prometheus.Labels
+	collector contextCollector
+}
+
+// scrapeCollectors are registered anew for every scrape of the metrics
+// handler, bound to the context of that scrape.
+var scrapeCollectors []scrapeCollector
+
+func registerScrapeCollector(labels prometheus.Labels, collector contextCollector) {
+	scrapeCollectors = append(scrapeCollectors, scrapeCollector{
+		labels:    labels,
+		collector: collector,
+	})
+}
+
+// scrapeContext bounds the work of a scrape by the timeout Prometheus
+// announces in the X-Prometheus-Scrape-Timeout-Seconds header, minus offset.
+func scrapeContext(r *http.Request, offset time.Duration) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - offset
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// MetricsHandler serves the metrics of the default registry together with
+// the metrics of all registered clusters.
+func MetricsHandler(exporterConfig *config.ExporterConfig) http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r, exporterConfig.ScrapeTimeoutOffset)
+		defer cancel()
+		registry := prometheus.NewRegistry()
+		for _, c := range scrapeCollectors {
+			prometheus.WrapRegistererWith(c.labels, registry).MustRegister(&boundCollector{ctx: ctx, collector: c.collector})
+		}
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+		// A cluster failing to gather must not hide the metrics of the others
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{
+			ErrorLog:      log.StandardLogger(),
+			ErrorHandling: promhttp.ContinueOnError,
+		}).ServeHTTP(w, r)
+	}))
+}
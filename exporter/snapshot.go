@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// snapshot is a read-only view of the Vitastor tree at a single etcd
+// revision. One snapshot is taken per scrape and shared by all collectors,
+// so metrics of a scrape never mix data from different points in time.
+type snapshot struct {
+	revision int64
+	kvs      map[string]*mvccpb.KeyValue
+}
+
+// snapshotSource provides snapshots of the Vitastor tree.
+type snapshotSource interface {
+	snapshot(ctx context.Context) (*snapshot, error)
+}
+
+// get returns the value stored at key, or nil if there is none.
+func (s *snapshot) get(key string) *mvccpb.KeyValue {
+	return s.kvs[key]
+}
+
+// list returns all keys starting with prefix, sorted by key.
+func (s *snapshot) list(prefix string) []*mvccpb.KeyValue {
+	var kvs []*mvccpb.KeyValue
+	for key, kv := range s.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, kv)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return string(kvs[i].Key) < string(kvs[j].Key)
+	})
+	return kvs
+}
+
+// etcdReader reads a snapshot straight from etcd. The first request fixes
+// the revision and all further requests are pinned to it.
+type etcdReader struct {
+	etcd   *etcdClient
+	prefix string
+	// paths are relative to prefix. A path ending with "/" is read as a
+	// prefix, any other path as a single key.
+	paths []string
+}
+
+func newEtcdReader(prefix string, etcd *etcdClient, paths []string) *etcdReader {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+	sort.Strings(unique)
+	return &etcdReader{
+		etcd:   etcd,
+		prefix: prefix,
+		paths:  unique,
+	}
+}
+
+func (r *etcdReader) snapshot(ctx context.Context) (*snapshot, error) {
+	snap := &snapshot{
+		kvs: make(map[string]*mvccpb.KeyValue),
+	}
+	for _, path := range r.paths {
+		var opts []clientv3.OpOption
+		if strings.HasSuffix(path, "/") {
+			opts = append(opts, clientv3.WithPrefix())
+		}
+		if snap.revision != 0 {
+			opts = append(opts, clientv3.WithRev(snap.revision))
+		}
+		resp, err := r.etcd.Get(ctx, r.prefix+path, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if snap.revision == 0 {
+			snap.revision = resp.Header.Revision
+		}
+		for _, kv := range resp.Kvs {
+			snap.kvs[string(kv.Key)] = kv
+		}
+	}
+	return snap, nil
+}
@@ -6,8 +6,6 @@ import (
 	config "github.com/Antilles7227/vitastor-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
-	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
 type statsCollector struct {
@@ -21,9 +19,10 @@ type statsCollector struct {
 	objectCount *prometheus.Desc
 
 	vitastorConfig *config.VitastorConfig
+	logger         *log.Entry
 }
 
-func newStatsCollector(conf *config.VitastorConfig) *statsCollector {
+func newStatsCollector(conf *config.VitastorConfig, logger *log.Entry) *statsCollector {
 	return &statsCollector{
 		statsBytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "global", "stat_bytes"),
 			"Global stat size",
@@ -58,6 +57,7 @@ func newStatsCollector(conf *config.VitastorConfig) *statsCollector {
 			[]string{"object_type"},
 			nil),
 		vitastorConfig: conf,
+		logger:         logger,
 	}
 }
 
@@ -74,32 +74,27 @@ func (collector *statsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.objectCount
 }
 
-func (collector *statsCollector) Collect(ch chan<- prometheus.Metric) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   collector.vitastorConfig.VitastorEtcdUrls,
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		log.Error(err, "Unable to connect to etcd")
-		return
-	}
-	defer cli.Close()
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+func (collector *statsCollector) name() string {
+	return "stats"
+}
+
+func (collector *statsCollector) paths() []string {
+	return []string{"/stats"}
+}
+
+func (collector *statsCollector) collect(ctx context.Context, snap *snapshot, ch chan<- prometheus.Metric) error {
 	globalStatsPath := collector.vitastorConfig.VitastorPrefix + "/stats"
-	globalStatsRaw, err := cli.Get(ctx, globalStatsPath)
-	cancel()
-	if err != nil {
-		log.Error(err, "Unable to get global state info")
-	}
+	globalStatsRaw := snap.get(globalStatsPath)
 
 	var globalStats config.VitastorStats
-	if globalStatsRaw.Count != 0 {
-		err = json.Unmarshal(globalStatsRaw.Kvs[0].Value, &globalStats)
+	if globalStatsRaw != nil {
+		err := json.Unmarshal(globalStatsRaw.Value, &globalStats)
 		if err != nil {
-			log.Error(err, "Unable to parse global stats")
+			collector.logger.Error(err, "Unable to parse global stats")
+			return err
 		}
 	} else {
-		return
+		return nil
 	}
 
 	for op, stats := range globalStats.OpStats {
@@ -200,4 +195,5 @@ func (collector *statsCollector) Collect(ch chan<- prometheus.Metric) {
 	if err == nil {
 		ch <- prometheus.MustNewConstMetric(collector.objectBytes, prometheus.CounterValue, bytes_object, "object")
 	}
+	return nil
 }
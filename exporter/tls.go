@@ -0,0 +1,140 @@
+package exporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tlsReloader serves the etcd CA and client certificate from disk and reloads
+// them whenever one of the files changes, so rotated certificates are used
+// for new connections without restarting the exporter.
+type tlsReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mu    sync.Mutex
+	stamp string
+	roots *x509.CertPool
+	cert  *tls.Certificate
+}
+
+func newTLSReloader(caFile, certFile, keyFile string) (*tlsReloader, error) {
+	r := &tlsReloader{
+		caFile:   caFile,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// fileStamp identifies the current version of the files by size and mtime.
+func (r *tlsReloader) fileStamp() (string, error) {
+	stamp := ""
+	for _, name := range []string{r.caFile, r.certFile, r.keyFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", name, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// reload rereads the files if they changed since the last load. On error the
+// previously loaded certificates stay in use.
+func (r *tlsReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return err
+	}
+	if stamp == r.stamp {
+		return nil
+	}
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		ca, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+	if r.stamp != "" {
+		log.Info("etcd TLS certificates changed on disk, reloaded")
+	}
+	r.stamp = stamp
+	r.roots = roots
+	r.cert = cert
+	return nil
+}
+
+func (r *tlsReloader) current() (*x509.CertPool, *tls.Certificate) {
+	if err := r.reload(); err != nil {
+		log.Error(err, "Unable to reload etcd TLS certificates, keeping previous ones")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roots, r.cert
+}
+
+// config returns a TLS config for connections to host that looks up the
+// certificates on every handshake. The built-in verification is replaced by
+// verifyConnection since tls.Config cannot swap RootCAs once handed to the
+// gRPC transport. host is checked against the server certificate the way
+// ServerName is, which also covers IP addresses that are never sent as SNI.
+func (r *tlsReloader) config(host string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verifyConnection(cs, host)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			_, cert := r.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+	}
+}
+
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState, host string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("etcd server presented no certificate")
+	}
+	roots, _ := r.current()
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
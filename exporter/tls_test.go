@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert issues a certificate for the given names, signed by parent or
+// self-signed if parent is nil.
+func testCert(t *testing.T, serial int64, dnsNames []string, ips []net.IP, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "etcd"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestVerifyConnection(t *testing.T) {
+	ca, caKey := testCert(t, 1, nil, nil, nil, nil)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := newTLSReloader(caFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipCert, _ := testCert(t, 2, nil, []net.IP{net.ParseIP("127.0.0.1")}, ca, caKey)
+	dnsCert, _ := testCert(t, 3, []string{"etcd1"}, nil, ca, caKey)
+	otherCa, otherCaKey := testCert(t, 4, nil, nil, nil, nil)
+	untrustedCert, _ := testCert(t, 5, nil, []net.IP{net.ParseIP("127.0.0.1")}, otherCa, otherCaKey)
+
+	tests := []struct {
+		name    string
+		host    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{"ip san", "127.0.0.1", ipCert, false},
+		{"ip san mismatch", "10.0.0.1", ipCert, true},
+		{"dns san for ip endpoint", "127.0.0.1", dnsCert, true},
+		{"dns san", "etcd1", dnsCert, false},
+		{"dns san mismatch", "etcd2", dnsCert, true},
+		{"untrusted ca", "127.0.0.1", untrustedCert, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// IP endpoints are never sent as SNI, so ServerName stays empty
+			cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+			err := reloader.config(tt.host).VerifyConnection(cs)
+			if tt.wantErr && err == nil {
+				t.Error("expected an error")
+			} else if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
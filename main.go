@@ -1,18 +1,15 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"net/http"
-	"os"
 	"strconv"
-	"strings"
+	"time"
 
 	_ "net/http/pprof"
 
 	vconfig "github.com/Antilles7227/vitastor-exporter/config"
 	exporter "github.com/Antilles7227/vitastor-exporter/exporter"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -22,14 +19,70 @@ func main() {
 	vitastorConfArg := flag.String("vitastor-conf", "/etc/vitastor/vitastor.conf", "Path to vitastor.conf (to obtain etcd connection params). Default: /etc/vitastor/vitastor.conf")
 	etcdUrlArg := flag.String("etcd-url", "", "Comma-separated list of etcd urls. WARNING: setting that param will override --vitastor-conf and ignore params in vitastor.conf. Default: empty")
 	vitastorPrefix := flag.String("vitastor-prefix", "/vitastor", "Etcd tree prefix for Vitastor cluster info. Default: /vitastor")
+	etcdCAFileArg := flag.String("etcd-ca-file", "", "Path to CA certificate of etcd. Overrides etcd_ca_file in vitastor.conf. Default: empty")
+	etcdCertFileArg := flag.String("etcd-cert-file", "", "Path to etcd client certificate. Overrides etcd_cert_file in vitastor.conf. Default: empty")
+	etcdKeyFileArg := flag.String("etcd-key-file", "", "Path to etcd client certificate key. Overrides etcd_key_file in vitastor.conf. Default: empty")
+	etcdUsernameArg := flag.String("etcd-username", "", "etcd username. Overrides etcd_username in vitastor.conf. Default: empty")
+	etcdPasswordFileArg := flag.String("etcd-password-file", "", "Path to file with etcd password. Overrides etcd_password_file in vitastor.conf. Default: empty")
+	clusterNameArg := flag.String("cluster-name", "default", "Value of cluster label when a single cluster is configured with flags or vitastor.conf. Default: default")
+	configArg := flag.String("config", "", "Path to exporter config listing several clusters. WARNING: setting that param will ignore --vitastor-conf and etcd flags. Default: empty")
+	probePathArg := flag.String("probe-path", "/probe", "Path of the multi-target probe endpoint. Default: /probe")
+	etcdWatchArg := flag.Bool("etcd-watch", true, "Keep an in-memory copy of the etcd tree updated by watch. If disabled, every scrape reads etcd at one pinned revision. Default: true")
+	pgStatsPerPGArg := flag.Bool("pg-stats-per-pg", false, "Export object counts and write OSD set of every PG, not only per-pool sums. Default: false")
+	osdInodeStatsLimitArg := flag.Int("osd-inode-stats-limit", 0, "Maximal number of OSD and image pairs to export IO counters from /osd/inodestats for. The pairs with the most bytes read, written and deleted since the previous scrape are kept, pairs exported last time win ties. 0 disables. Default: 0")
+	osdSpacePerImageArg := flag.Bool("osd-space-per-image", true, "Export space used by every image on every OSD from /osd/space, not only per-image and per-pool sums. Set to false on large clusters to cut the number of series. Default: true")
+	recoveryRateWindowArg := flag.Duration("recovery-rate-window", 5*time.Minute, "Time over which the recovery rate of pools is measured for the recovery ETA. Default: 5m")
+	etcdDialTimeoutArg := flag.Duration("etcd-dial-timeout", 5*time.Second, "Timeout of connecting to one etcd endpoint. Default: 5s")
+	etcdRequestTimeoutArg := flag.Duration("etcd-request-timeout", 5*time.Second, "Timeout of one attempt of an etcd request. Default: 5s")
+	etcdRetriesArg := flag.Int("etcd-retries", 2, "Number of retries of a failed etcd request. Default: 2")
+	etcdRetryBackoffArg := flag.Duration("etcd-retry-backoff", 200*time.Millisecond, "Initial delay between retries of etcd requests, doubled on every retry with jitter. Default: 200ms")
+	etcdRetryMaxBackoffArg := flag.Duration("etcd-retry-max-backoff", 2*time.Second, "Maximal delay between retries of etcd requests. Default: 2s")
+	etcdBreakerFailuresArg := flag.Int("etcd-breaker-failures", 3, "Number of consecutive failures after which an etcd endpoint is skipped for --etcd-breaker-cooldown. 0 disables. Default: 3")
+	etcdBreakerCooldownArg := flag.Duration("etcd-breaker-cooldown", 30*time.Second, "How long a failing etcd endpoint is skipped. Default: 30s")
+	collectorTimeoutArg := flag.Duration("collector-timeout", 20*time.Second, "Time a collector may spend on one scrape. Default: 20s")
+	collectorTimeoutsArg := flag.String("collector-timeouts", "", "Comma-separated per-collector timeouts overriding --collector-timeout, e.g. snapshot=10s,etcd=3s. Default: empty")
+	scrapeTimeoutOffsetArg := flag.Duration("scrape-timeout-offset", 500*time.Millisecond, "Subtracted from the scrape timeout sent by Prometheus to leave time for the response. Default: 500ms")
 	flag.Parse()
 
+	collectorTimeouts, err := vconfig.ParseCollectorTimeouts(*collectorTimeoutsArg)
+	if err != nil {
+		log.Fatal(err, "Invalid --collector-timeouts")
+	}
+	exporterConfig := vconfig.ExporterConfig{
+		EtcdWatch:           *etcdWatchArg,
+		PGStatsPerPG:        *pgStatsPerPGArg,
+		OSDInodeStatsLimit:  *osdInodeStatsLimitArg,
+		OSDSpacePerImage:    *osdSpacePerImageArg,
+		RecoveryRateWindow:  *recoveryRateWindowArg,
+		EtcdDialTimeout:     *etcdDialTimeoutArg,
+		EtcdRequestTimeout:  *etcdRequestTimeoutArg,
+		EtcdRetries:         *etcdRetriesArg,
+		EtcdRetryBackoff:    *etcdRetryBackoffArg,
+		EtcdRetryMaxBackoff: *etcdRetryMaxBackoffArg,
+		BreakerFailures:     *etcdBreakerFailuresArg,
+		BreakerCooldown:     *etcdBreakerCooldownArg,
+		CollectorTimeout:    *collectorTimeoutArg,
+		CollectorTimeouts:   collectorTimeouts,
+		ScrapeTimeoutOffset: *scrapeTimeoutOffsetArg,
+	}
+
+	if *configArg != "" {
+		configFile, err := vconfig.LoadConfigFile(*configArg)
+		if err != nil {
+			log.Fatal(err, "Unable to load exporter config")
+		}
+		log.Info("Exporter config loaded, clusters: ", len(configFile.Clusters), ", probe profiles: ", len(configFile.ProbeProfiles))
+		exporter.Register(configFile.Clusters, &exporterConfig)
+		serve(*uriArg, *probePathArg, configFile.ProbeProfiles, &exporterConfig, *portArg)
+		return
+	}
+
 	config := vconfig.VitastorConfig{
 		VitastorPrefix:   *vitastorPrefix,
-		VitastorEtcdUrls: strings.Split(*etcdUrlArg, ","),
+		VitastorEtcdUrls: vconfig.ParseEtcdAddress(*etcdUrlArg),
 	}
 	log.Info("Trying to load vitastor.conf")
-	err := loadConfiguration(*vitastorConfArg, &config)
+	err = loadConfiguration(*vitastorConfArg, &config)
 	if err != nil {
 		log.Info("Unable to load vitastor.conf, using command-line args")
 	} else {
@@ -37,24 +90,44 @@ func main() {
 	}
 	if *etcdUrlArg != "" {
 		log.Info("etcdUrlArg is set, overriding params in vitastor.conf")
-		config.VitastorEtcdUrls = strings.Split(*etcdUrlArg, ",")
+		config.VitastorEtcdUrls = vconfig.ParseEtcdAddress(*etcdUrlArg)
 		config.VitastorPrefix = *vitastorPrefix
 	}
+	if *etcdCAFileArg != "" {
+		config.EtcdCAFile = *etcdCAFileArg
+	}
+	if *etcdCertFileArg != "" {
+		config.EtcdCertFile = *etcdCertFileArg
+	}
+	if *etcdKeyFileArg != "" {
+		config.EtcdKeyFile = *etcdKeyFileArg
+	}
+	if *etcdUsernameArg != "" {
+		config.EtcdUsername = *etcdUsernameArg
+	}
+	if *etcdPasswordFileArg != "" {
+		config.EtcdPasswordFile = *etcdPasswordFileArg
+	}
+	err = config.Normalize()
+	if err != nil {
+		log.Fatal(err, "Invalid etcd connection settings")
+	}
 
-	exporter.Register(&config)
+	exporter.Register([]vconfig.ClusterConfig{{Name: *clusterNameArg, VitastorConfig: config}}, &exporterConfig)
+	serve(*uriArg, *probePathArg, nil, &exporterConfig, *portArg)
+}
 
-	http.Handle(*uriArg, promhttp.Handler())
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(*portArg), nil))
+func serve(uri string, probeUri string, probeProfiles map[string]vconfig.ClusterConfig, exporterConfig *vconfig.ExporterConfig, port int) {
+	http.Handle(uri, exporter.MetricsHandler(exporterConfig))
+	http.Handle(probeUri, exporter.NewProbeHandler(probeProfiles, exporterConfig))
+	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(port), nil))
 }
 
 func loadConfiguration(file string, config *vconfig.VitastorConfig) error {
-	configFile, err := os.Open(file)
+	err := vconfig.LoadVitastorConfig(file, config)
 	if err != nil {
-		log.Error(err, "Unable to open config")
+		log.Error(err, "Unable to load config")
 		return err
 	}
-	defer configFile.Close()
-	jsonParser := json.NewDecoder(configFile)
-	jsonParser.Decode(&config)
 	return nil
 }